@@ -1,10 +1,16 @@
 package main
 
+//go:generate go run ./handlers_gen -out api_handlers.go -client api_client.go -router
+
 import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/soypita/api-generator/apitypes"
 )
 
 // вы можете использовать ApiError в коде, который получается в результате генерации
@@ -26,11 +32,15 @@ const (
 	statusAdmin     = 20
 )
 
+// apigen:api {"cors": {"origins": ["https://example.com"], "credentials": true, "maxage": 600}}
 type MyApi struct {
 	statuses map[string]int
+	sessions map[string]string
 	users    map[string]*User
 	nextID   uint64
 	mu       *sync.RWMutex
+	// panics хранит эндпоинты, в которых случилась паника
+	panics []string
 }
 
 func NewMyApi() *MyApi {
@@ -40,6 +50,10 @@ func NewMyApi() *MyApi {
 			"moderator": 10,
 			"admin":     20,
 		},
+		sessions: map[string]string{
+			"100500": "rvasily",
+			"100501": "vpupkin",
+		},
 		users: map[string]*User{
 			"rvasily": &User{
 				ID:       42,
@@ -47,16 +61,75 @@ func NewMyApi() *MyApi {
 				FullName: "Vasily Romanov",
 				Status:   statusAdmin,
 			},
+			"vpupkin": &User{
+				ID:       41,
+				Login:    "vpupkin",
+				FullName: "Vasily Pupkin",
+				Status:   statusUser,
+			},
 		},
 		nextID: 43,
 		mu:     &sync.RWMutex{},
 	}
 }
 
+type ctxKey int
+
+const userLoginKey ctxKey = iota
+
+// Authenticate находит пользователя по токену из заголовка X-Auth
+func (srv *MyApi) Authenticate(r *http.Request) (context.Context, error) {
+	login, ok := srv.sessions[r.Header.Get("X-Auth")]
+	if !ok {
+		return nil, ApiError{http.StatusForbidden, fmt.Errorf("unauthorized")}
+	}
+	return context.WithValue(r.Context(), userLoginKey, login), nil
+}
+
+// OnPanic запоминает эндпоинт и значение паники
+func (srv *MyApi) OnPanic(ctx context.Context, endpoint string, v interface{}, stack []byte) {
+	srv.mu.Lock()
+	srv.panics = append(srv.panics, fmt.Sprintf("%s: %v", endpoint, v))
+	srv.mu.Unlock()
+}
+
+// RateLimitKey ограничивает запросы по логину, а не по токену
+func (srv *MyApi) RateLimitKey(ctx context.Context) string {
+	login, _ := ctx.Value(userLoginKey).(string)
+	return login
+}
+
+// Roles возвращает роль пользователя, найденного в Authenticate
+func (srv *MyApi) Roles(ctx context.Context) ([]string, error) {
+	login, _ := ctx.Value(userLoginKey).(string)
+
+	srv.mu.RLock()
+	user, exist := srv.users[login]
+	srv.mu.RUnlock()
+	if !exist {
+		return nil, ApiError{http.StatusForbidden, fmt.Errorf("user not exist")}
+	}
+
+	for role, status := range srv.statuses {
+		if status == user.Status {
+			return []string{role}, nil
+		}
+	}
+	return nil, nil
+}
+
 type ProfileParams struct {
 	Login string `apivalidator:"required"`
 }
 
+type UserPathParams struct {
+	Login UserLogin `apivalidator:"path=login,required"`
+}
+
+type UserIDParams struct {
+	ID int `apivalidator:"path=id,min=1"`
+}
+
 type CreateParams struct {
 	Login  string `apivalidator:"required,min=10"`
 	Name   string `apivalidator:"paramname=full_name"`
@@ -71,6 +144,10 @@ type User struct {
 	Status   int    `json:"status"`
 }
 
+type CreateCheck struct {
+	Valid bool `json:"valid"`
+}
+
 type NewUser struct {
 	ID uint64 `json:"id"`
 }
@@ -81,6 +158,18 @@ func (srv *MyApi) Profile(ctx context.Context, in ProfileParams) (*User, error)
 	if in.Login == "bad_user" {
 		return nil, fmt.Errorf("bad user")
 	}
+	if in.Login == "panic_user" {
+		panic("panic user")
+	}
+	if in.Login == "slow_user" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if in.Login == "lazy_user" {
+		// контекст не проверяется
+		time.Sleep(500 * time.Millisecond)
+		return nil, fmt.Errorf("too late")
+	}
 
 	srv.mu.RLock()
 	user, exist := srv.users[in.Login]
@@ -92,7 +181,94 @@ func (srv *MyApi) Profile(ctx context.Context, in ProfileParams) (*User, error)
 	return user, nil
 }
 
-// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}
+// apigen:api {"url": "/user/{login}/profile", "auth": false, "timeout": "50ms"}
+func (srv *MyApi) UserProfile(ctx context.Context, in UserPathParams) (*User, error) {
+	return srv.Profile(ctx, ProfileParams{Login: string(in.Login)})
+}
+
+// apigen:api {"url": "/user/by-id/{id:int}", "auth": false}
+func (srv *MyApi) UserByID(ctx context.Context, in UserIDParams) (*User, error) {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+
+	for _, user := range srv.users {
+		if user.ID == uint64(in.ID) {
+			return user, nil
+		}
+	}
+	return nil, ApiError{http.StatusNotFound, fmt.Errorf("user not exist")}
+}
+
+// apigen:api {"url": "/user/list", "auth": false}
+func (srv *MyApi) List(ctx context.Context, in ListFilter) (*UserList, error) {
+	srv.mu.RLock()
+	users := make([]*User, 0, len(srv.users))
+	for _, user := range srv.users {
+		if float64(user.Status) < in.MinStatus || in.Admins && user.Status != statusAdmin {
+			continue
+		}
+		if len(in.Logins) > 0 && !containsString(in.Logins, user.Login) {
+			continue
+		}
+		if len(in.Statuses) > 0 && !containsInt(in.Statuses, user.Status) {
+			continue
+		}
+		users = append(users, user)
+	}
+	srv.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	res := &UserList{Total: len(users), Users: []*User{}}
+	if in.Offset < int64(len(users)) {
+		users = users[in.Offset:]
+		if len(users) > int(in.Limit) {
+			users = users[:in.Limit]
+		}
+		res.Users = users
+	}
+	return res, nil
+}
+
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, val int) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+// параметры и результат могут быть из другого пакета
+
+// apigen:api {"url": "/user/count", "auth": false, "method": ["GET", "POST"], "cors": {"origins": ["*"], "headers": ["X-Client"]}}
+func (srv *MyApi) Count(ctx context.Context, in apitypes.CountParams) (*apitypes.Count, error) {
+	status := srv.statuses[string(in.Status)]
+	res := &apitypes.Count{}
+	srv.mu.RLock()
+	for _, user := range srv.users {
+		if user.Status == status {
+			res.Total++
+		}
+	}
+	srv.mu.RUnlock()
+	return res, nil
+}
+
+// apigen:api {"url": "/user/create/check", "auth": false, "collecterrors": true}
+func (srv *MyApi) CheckCreate(ctx context.Context, in CreateParams) (*CreateCheck, error) {
+	return &CreateCheck{Valid: true}, nil
+}
+
+// apigen:api {"url": "/user/create", "auth": true, "method": "POST", "roles": ["admin", "moderator"], "ratelimit": "100/s key=auth"}
 func (srv *MyApi) Create(ctx context.Context, in CreateParams) (*NewUser, error) {
 	if in.Login == "bad_username" {
 		return nil, fmt.Errorf("bad user")
@@ -123,6 +299,7 @@ func (srv *MyApi) Create(ctx context.Context, in CreateParams) (*NewUser, error)
 // код, созданный вашим кодогенератором работает с конкретной струткурой, про другие ничего не знает
 // поэтому то что рядом есть ещё походая структура с такими же методами его нисколько не смущает
 
+// apigen:api {"prefix": "/other"}
 type OtherApi struct {
 }
 
@@ -130,6 +307,14 @@ func NewOtherApi() *OtherApi {
 	return &OtherApi{}
 }
 
+func (srv *OtherApi) Authenticate(r *http.Request) (context.Context, error) {
+	if r.Header.Get("X-Auth") != "100500" {
+		return nil, ApiError{http.StatusForbidden, fmt.Errorf("unauthorized")}
+	}
+	// контекст запроса не меняется
+	return nil, nil
+}
+
 type OtherCreateParams struct {
 	Username string `apivalidator:"required,min=3"`
 	Name     string `apivalidator:"paramname=account_name"`
@@ -144,7 +329,7 @@ type OtherUser struct {
 	Level    int    `json:"level"`
 }
 
-// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}
+// apigen:api {"url": "/user/create", "auth": true, "method": "POST", "ratelimit": "10/m key=header:X-Client"}
 func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUser, error) {
 	return &OtherUser{
 		ID:       12,
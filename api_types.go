@@ -0,0 +1,22 @@
+package main
+
+// типы параметров и результатов могут быть объявлены в других файлах пакета
+
+// именованные типы и алиасы разбираются по их базовым типам
+type UserLogin string
+
+type ListFilter = ListParams
+
+type ListParams struct {
+	Limit     uint32  `apivalidator:"default=10,min=1,max=100"`
+	Offset    int64   `apivalidator:"min=0"`
+	MinStatus float64 `apivalidator:"paramname=min_status,min=0,max=20"`
+	Admins    bool
+	Logins    []string `apivalidator:"paramname=login,maxitems=3,unique"`
+	Statuses  []int    `apivalidator:"paramname=status,comma,min=0,max=20"`
+}
+
+type UserList struct {
+	Total int     `json:"total"`
+	Users []*User `json:"users"`
+}
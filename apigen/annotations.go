@@ -0,0 +1,292 @@
+package apigen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// collectTypeSpecs records every type declared in the file
+func (m *Model) collectTypeSpecs(node *ast.File) {
+	for _, f := range node.Decls {
+		g, ok := f.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range g.Specs {
+			currType, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			m.typeSpecs[currType.Name.Name] = currType
+		}
+	}
+}
+
+// collectReceiverAnnotations reads apigen:api of type declarations of the file
+func (m *Model) collectReceiverAnnotations(d *diagnostics, node *ast.File) {
+	for _, f := range node.Decls {
+		g, ok := f.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range g.Specs {
+			currType := spec.(*ast.TypeSpec)
+			doc := currType.Doc
+			if doc == nil && len(g.Specs) == 1 {
+				doc = g.Doc
+			}
+			if doc == nil || !strings.HasPrefix(doc.Text(), "apigen:api") {
+				continue
+			}
+			var annotation receiverAnnotation
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(doc.Text(), "apigen:api ")), &annotation); err != nil {
+				d.errorf(doc.Pos(), "apigen:api: invalid JSON: %v", err)
+				continue
+			}
+			if err := checkPrefix(annotation.Prefix); err != nil {
+				d.errorf(doc.Pos(), "apigen:api: %v", err)
+				continue
+			}
+			if err := checkCORS(annotation.CORS); err != nil {
+				d.errorf(doc.Pos(), "apigen:api: %v", err)
+				continue
+			}
+			m.annotations[currType.Name.Name] = annotation
+		}
+	}
+}
+
+// collectFuncDescriptions reads annotated methods of the file, invalid ones are added to diagnostics
+func (m *Model) collectFuncDescriptions(d *diagnostics, pkg *types.Package, info *types.Info, node *ast.File, only map[string]bool) {
+	for _, f := range node.Decls {
+		g, ok := f.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if g.Recv == nil {
+			continue
+		}
+		if g.Doc == nil {
+			continue
+		}
+
+		if !strings.HasPrefix(g.Doc.Text(), "apigen:api") {
+			continue
+		}
+		if only != nil && !only[receiverName(g.Recv)] {
+			continue
+		}
+
+		// annotation overrides defaults of the configuration
+		generatedStruct := m.Config.seed()
+		inParam := strings.TrimPrefix(g.Doc.Text(), "apigen:api ")
+
+		err := json.Unmarshal([]byte(inParam), &generatedStruct)
+		if err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: invalid JSON: %v", err)
+			continue
+		}
+		if generatedStruct.Url == "" {
+			d.errorf(g.Doc.Pos(), "apigen:api: url is required")
+			continue
+		}
+		if err := checkURLTemplate(generatedStruct.Url); err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+			continue
+		}
+		if err := checkMethods(generatedStruct.Methods); err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+			continue
+		}
+		if generatedStruct.Timeout != "" {
+			timeout, err := time.ParseDuration(generatedStruct.Timeout)
+			if err != nil || timeout <= 0 {
+				d.errorf(g.Doc.Pos(), "apigen:api: timeout %q must be a positive duration like 2s", generatedStruct.Timeout)
+				continue
+			}
+			generatedStruct.timeout = timeout
+		}
+		if err := m.checkEndpointPrefix(receiverName(g.Recv), generatedStruct.Prefix); err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+			continue
+		}
+		// authorization needs identity of the caller
+		if len(generatedStruct.Roles) > 0 || len(generatedStruct.Scopes) > 0 {
+			generatedStruct.Auth = true
+		}
+		if generatedStruct.RateLimit != "" {
+			rl, err := parseRateLimit(generatedStruct.RateLimit, m.Config.AuthHeader)
+			if err != nil {
+				d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+				continue
+			}
+			if rl.Key == "auth" && !generatedStruct.Auth {
+				d.errorf(g.Doc.Pos(), "apigen:api: ratelimit key=auth needs auth")
+				continue
+			}
+			generatedStruct.rateLimit = rl
+		}
+		if generatedStruct.CORS == nil {
+			generatedStruct.CORS = m.annotations[receiverName(g.Recv)].CORS
+		} else if err := checkCORS(generatedStruct.CORS); err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+			continue
+		}
+		generatedStruct.FuncName = g.Name.Name
+		generatedStruct.pos = g.Doc.Pos()
+		if !m.checkSignature(d, pkg, info, g, &generatedStruct) {
+			continue
+		}
+		if err := checkPathBinding(generatedStruct.Url, m.params[generatedStruct.InputBusinessParamName]); err != nil {
+			d.errorf(g.Doc.Pos(), "apigen:api: %v", err)
+			continue
+		}
+		m.addEndpoint(generatedStruct)
+	}
+}
+
+// receiverName returns the name of the receiver type, methods of other receivers
+// are type checked only when they are generated
+func receiverName(recv *ast.FieldList) string {
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// paramFieldName returns name of the request parameter the field is bound to
+func paramFieldName(filed ParamField) string {
+	if filed.Attr.PathName != "" {
+		return filed.Attr.PathName
+	}
+	if filed.Attr.ParamName != "" {
+		return filed.Attr.ParamName
+	}
+	return strings.ToLower(filed.Name)
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// formatLimit renders min and max values as go constants
+func formatLimit(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// durationExpr renders the duration as go expression in the largest unit dividing it
+func durationExpr(d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"time.Hour", time.Hour},
+		{"time.Minute", time.Minute},
+		{"time.Second", time.Second},
+		{"time.Millisecond", time.Millisecond},
+		{"time.Microsecond", time.Microsecond},
+	}
+	for _, unit := range units {
+		if d%unit.size == 0 {
+			return strconv.FormatInt(int64(d/unit.size), 10) + " * " + unit.name
+		}
+	}
+	return "time.Duration(" + strconv.FormatInt(int64(d), 10) + ")"
+}
+
+// parseValidateAttr reads apivalidator tag of the struct field
+func parseValidateAttr(tag string) (ValidateAttr, error) {
+	valParams := ValidateAttr{}
+	tags := reflect.StructTag(tag)
+	if jsonTag, ok := tags.Lookup("json"); ok {
+		valParams.JSONName = strings.Split(jsonTag, ",")[0]
+	}
+	tagString, _ := tags.Lookup("apivalidator")
+	if tagString == "" {
+		return valParams, nil
+	}
+	paramsList := strings.Split(tagString, ",")
+	for _, paramTag := range paramsList {
+		if paramTag == "required" {
+			valParams.IsRequired = true
+			continue
+		}
+		if paramTag == "unique" {
+			valParams.Unique = true
+			continue
+		}
+		if paramTag == "comma" {
+			valParams.CommaSeparated = true
+			continue
+		}
+		if strings.HasPrefix(paramTag, "minitems=") {
+			minItems, err := strconv.Atoi(strings.TrimPrefix(paramTag, "minitems="))
+			if err != nil {
+				return valParams, fmt.Errorf("bad %s, integer expected", paramTag)
+			}
+			valParams.MinItems = minItems
+			continue
+		}
+		if strings.HasPrefix(paramTag, "maxitems=") {
+			maxItems, err := strconv.Atoi(strings.TrimPrefix(paramTag, "maxitems="))
+			if err != nil {
+				return valParams, fmt.Errorf("bad %s, integer expected", paramTag)
+			}
+			valParams.MaxItems, valParams.HasMaxItems = maxItems, true
+			continue
+		}
+
+		if strings.HasPrefix(paramTag, "path=") {
+			valParams.PathName = strings.TrimPrefix(paramTag, "path=")
+			continue
+		}
+
+		if strings.HasPrefix(paramTag, "paramname=") {
+			valParams.ParamName = strings.TrimPrefix(paramTag, "paramname=")
+			continue
+		}
+
+		if strings.HasPrefix(paramTag, "default=") {
+			valParams.DefaultValue = strings.TrimPrefix(paramTag, "default=")
+			continue
+		}
+
+		if strings.HasPrefix(paramTag, "enum=") {
+			valParams.EnumValues = strings.Split(strings.TrimPrefix(paramTag, "enum="), "|")
+			continue
+		}
+		if strings.HasPrefix(paramTag, "min=") {
+			minVal, err := strconv.ParseFloat(strings.TrimPrefix(paramTag, "min="), 64)
+			if err != nil {
+				return valParams, fmt.Errorf("bad %s, number expected", paramTag)
+			}
+			valParams.Min, valParams.HasMin = minVal, true
+			continue
+		}
+		if strings.HasPrefix(paramTag, "max=") {
+			maxVal, err := strconv.ParseFloat(strings.TrimPrefix(paramTag, "max="), 64)
+			if err != nil {
+				return valParams, fmt.Errorf("bad %s, number expected", paramTag)
+			}
+			valParams.Max, valParams.HasMax = maxVal, true
+			continue
+		}
+		return valParams, fmt.Errorf("unknown option %q", paramTag)
+	}
+
+	return valParams, nil
+}
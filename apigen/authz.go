@@ -0,0 +1,96 @@
+package apigen
+
+import (
+	"strconv"
+	"strings"
+)
+
+// authData is passed to the authHelpers template
+type authData struct {
+	// Auth, Roles and Scopes are set when some endpoint is annotated with them
+	Auth   bool
+	Roles  bool
+	Scopes bool
+}
+
+// authHelpersTemplate declares interfaces receivers implement to authenticate and authorize callers
+// and checks of roles and scopes they return, data is authData
+const authHelpersTemplate = `
+{{- if .Auth -}}
+// Authenticator must be implemented by receivers with endpoints annotated with auth,
+// returned context is passed to the handler, nil keeps the context of the request,
+// ApiError sets the response status, 401 otherwise
+type Authenticator interface {
+	Authenticate(r *http.Request) (context.Context, error)
+}
+
+{{end}}
+{{- if .Roles -}}
+// RoleResolver must be implemented by receivers with endpoints annotated with roles,
+// ctx is the one returned by Authenticate
+type RoleResolver interface {
+	Roles(ctx context.Context) ([]string, error)
+}
+
+{{end}}
+{{- if .Scopes -}}
+// ScopeResolver must be implemented by receivers with endpoints annotated with scopes,
+// ctx is the one returned by Authenticate
+type ScopeResolver interface {
+	Scopes(ctx context.Context) ([]string, error)
+}
+
+{{end}}
+{{- if or .Roles .Scopes -}}
+// apigenHasAny reports whether granted contains any of required
+func apigenHasAny(granted []string, required ...string) bool {
+	for _, val := range required {
+		for _, have := range granted {
+			if have == val {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// apigenHasAll reports whether granted contains all of required
+func apigenHasAll(granted []string, required ...string) bool {
+	for _, val := range required {
+		if !apigenHasAny(granted, val) {
+			return false
+		}
+	}
+	return true
+}
+{{- end}}
+`
+
+func (m *Model) hasAuthorization() bool {
+	for _, val := range m.endpoints() {
+		if len(val.Roles) > 0 || len(val.Scopes) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// auth tells which of authentication and authorization annotations are used
+func (m *Model) auth() authData {
+	res := authData{}
+	for _, val := range m.endpoints() {
+		res.Auth = res.Auth || val.Auth
+		res.Roles = res.Roles || len(val.Roles) > 0
+		res.Scopes = res.Scopes || len(val.Scopes) > 0
+	}
+	return res
+}
+
+// quoteList renders values as go string literals separated by commas
+func quoteList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, val := range values {
+		quoted = append(quoted, strconv.Quote(val))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,407 @@
+package apigen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// clientHelpersData is passed to the clientHelpers template
+type clientHelpersData struct {
+	// AuthHeader carries the token, Envelope names fields of the response
+	AuthHeader string
+	Envelope   EnvelopeConfig
+}
+
+// clientHelpersTemplate sends requests built by the typed clients and unpacks the envelope, data is clientHelpersData
+const clientHelpersTemplate = `// apigenClientDo sends params in the query or in the form body and decodes the response of envelope into res
+func apigenClientDo(ctx context.Context, httpClient *http.Client, method string, target string, token string, params url.Values, res interface{}) error {
+	var body io.Reader
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete {
+		target += "?" + params.Encode()
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if token != "" {
+		req.Header.Set({{quote .AuthHeader}}, token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	envelope := struct {
+		Error    string            ` + "`json:\"{{.Envelope.Error}}\"`" + `
+		Response json.RawMessage   ` + "`json:\"{{.Envelope.Response}}\"`" + `
+		Fields   map[string]string ` + "`json:\"{{.Envelope.Fields}}\"`" + `
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return ApiError{resp.StatusCode, errors.New(resp.Status)}
+		}
+		return fmt.Errorf("malformed response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(envelope.Fields) > 0 {
+			return ApiError{resp.StatusCode, ValidationError{envelope.Fields}}
+		}
+		return ApiError{resp.StatusCode, errors.New(envelope.Error)}
+	}
+	return json.Unmarshal(envelope.Response, res)
+}
+`
+
+// clientErrorsTemplate is written by the client living outside of the package with handlers,
+// the types have the same shape as ApiError expected by the generated handlers
+const clientErrorsTemplate = `type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+// ValidationError lists every invalid parameter reported by the server
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (ve ValidationError) Error() string {
+	return "validation failed"
+}
+`
+
+// clientData is passed to the client template
+type clientData struct {
+	Receiver   string
+	Prefix     string
+	AuthHeader string
+	Endpoints  []clientEndpoint
+}
+
+// clientEndpoint describes the request of a single endpoint
+type clientEndpoint struct {
+	FuncGeneratorDescription
+	// Method is GET when the endpoint accepts it, Path is go expression of the url
+	Method string
+	Path   string
+	// Params are fields sent in the query or in the form body
+	Params []ParamField
+}
+
+// clientTemplate writes the typed client of the receiver, data is clientData
+const clientTemplate = `// {{.Receiver}}Client calls {{.Receiver}} endpoints over http
+type {{.Receiver}}Client struct {
+{{- if .Prefix}}
+	// BaseURL ends with {{.Prefix}} when {{.Receiver}} is served by Router
+{{- end}}
+	BaseURL string
+	// Token is sent in {{.AuthHeader}} header to endpoints with auth
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New{{.Receiver}}Client(baseURL string, token string) *{{.Receiver}}Client {
+	return &{{.Receiver}}Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, HTTPClient: http.DefaultClient}
+}
+{{- range .Endpoints}}
+
+func (c *{{$.Receiver}}Client) {{.FuncName}}(ctx context.Context, in {{.InputBusinessParamName}}) (*{{.OutputBusinessParamName}}, error) {
+	params := url.Values{}
+{{- range .Params}}{{template "clientParam" .}}{{end}}
+	res := new({{.OutputBusinessParamName}})
+	err := apigenClientDo(ctx, c.HTTPClient, {{quote .Method}}, c.BaseURL+{{.Path}}, {{if .Auth}}c.Token{{else}}""{{end}}, params, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+{{- end}}
+{{- define "clientParam"}}
+{{- if .IsSlice}}
+	for _, item := range in.{{.Name}} {
+		params.Add({{quote .FormName}}, {{clientValue .Scalar .ElemTypeName "item"}})
+	}
+{{- else if .SendsZero}}
+	params.Set({{quote .FormName}}, {{clientValue .Scalar .TypeName (print "in." .Name)}})
+{{- else}}
+	if in.{{.Name}}{{if eq .Kind "string"}} != ""{{else if ne .Kind "bool"}} != 0{{end}} {
+		params.Set({{quote .FormName}}, {{clientValue .Scalar .TypeName (print "in." .Name)}})
+	}
+{{- end}}
+{{- end}}
+`
+
+// clientImports may be used by the client, the ones it does not use are dropped
+var clientImports = map[string]bool{
+	"context":       true,
+	"encoding/json": true,
+	"errors":        true,
+	"fmt":           true,
+	"io":            true,
+	"net/http":      true,
+	"net/url":       true,
+	"strconv":       true,
+	"strings":       true,
+}
+
+// writeClient writes typed clients of all receivers, clients in other package
+// get copies of params and result types
+func (m *Model) writeClient(w io.Writer, tmpl *template.Template, pkgName string) error {
+	out := &bytes.Buffer{}
+	ownPackage := pkgName != m.Package
+	var typeDecls []*ast.TypeSpec
+	var imports []string
+	if ownPackage {
+		var err error
+		typeDecls, imports, err = m.clientTypeDecls()
+		if err != nil {
+			return err
+		}
+	}
+	// imported parameters and results are referred by package names
+	for _, path := range sortedImports(m.paramImports, m.resultImports) {
+		if !containsString(imports, path) {
+			imports = append(imports, path)
+		}
+	}
+
+	if ownPackage {
+		if err := executeTemplate(out, tmpl, "clientErrors", nil); err != nil {
+			return err
+		}
+		for _, spec := range typeDecls {
+			printer.Fprint(out, m.fset, &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}})
+			fmt.Fprintln(out)
+			fmt.Fprintln(out)
+		}
+	}
+	helpers := clientHelpersData{AuthHeader: m.Config.AuthHeader, Envelope: m.Config.Envelope}
+	if err := executeTemplate(out, tmpl, "clientHelpers", helpers); err != nil {
+		return err
+	}
+
+	for _, recv := range m.Receivers {
+		if err := executeTemplate(out, tmpl, "client", m.client(recv)); err != nil {
+			return err
+		}
+	}
+
+	// unused imports are dropped by formatGenerated
+	for path := range clientImports {
+		imports = append(imports, strconv.Quote(path))
+	}
+	res, err := m.formatGenerated(pkgName, imports, out.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res)
+	return err
+}
+
+// client describes requests of every endpoint of the receiver
+func (m *Model) client(recv *Receiver) clientData {
+	res := clientData{Receiver: recv.Name, Prefix: recv.Prefix, AuthHeader: m.Config.AuthHeader}
+	for _, val := range recv.Endpoints {
+		// GET is used when the endpoint accepts it
+		method := "GET"
+		if len(val.Methods) > 0 && !val.Methods.Has(method) {
+			method = val.Methods[0]
+		}
+		endpoint := clientEndpoint{FuncGeneratorDescription: val, Method: method}
+		pathValues := make(map[string]string)
+		for _, filed := range m.ParamsOf(val).Fields {
+			if filed.Attr.PathName != "" {
+				pathValues[filed.Attr.PathName] = formatClientValue(filed.Scalar, filed.TypeName, "in."+filed.Name)
+				continue
+			}
+			endpoint.Params = append(endpoint.Params, filed)
+		}
+		endpoint.Path = clientPath(val.Url, pathValues)
+		res.Endpoints = append(res.Endpoints, endpoint)
+	}
+	return res
+}
+
+// clientPath builds go expression of the url with escaped path parameters
+func clientPath(url string, pathValues map[string]string) string {
+	if !isURLTemplate(url) {
+		return strconv.Quote(url)
+	}
+	params := urlTemplateParams(url)
+	parts := []string{}
+	static := ""
+	for i, segment := range strings.Split(url, "/") {
+		if i > 0 {
+			static += "/"
+		}
+		if !strings.HasPrefix(segment, "{") {
+			static += segment
+			continue
+		}
+		param := params[0]
+		params = params[1:]
+		// every path parameter is bound to a field, it is checked with annotations
+		parts = append(parts, strconv.Quote(static), "url.PathEscape("+pathValues[param.name]+")")
+		static = ""
+	}
+	if static != "" {
+		parts = append(parts, strconv.Quote(static))
+	}
+	return strings.Join(parts, "+")
+}
+
+// SendsZero reports whether the client sends zero of the field, other zero values are not sent,
+// so the server applies defaults: required fields are always sent, and the server replaces
+// missing bool and number with the default, so zero is sent when the default is not zero
+// and zero passes checks of the field, otherwise it can not be a value the caller chose
+func (f ParamField) SendsZero() bool {
+	if f.Attr.IsRequired {
+		return true
+	}
+	if f.Attr.DefaultValue == "" {
+		return false
+	}
+	switch f.Kind() {
+	case "bool":
+		val, err := strconv.ParseBool(f.Attr.DefaultValue)
+		return err == nil && val
+	case "int", "uint", "float":
+		val, err := strconv.ParseFloat(f.Attr.DefaultValue, 64)
+		if err != nil || val == 0 || f.Attr.HasMin && f.Attr.Min > 0 || f.Attr.HasMax && f.Attr.Max < 0 {
+			return false
+		}
+		if len(f.Attr.EnumValues) == 0 {
+			return true
+		}
+		for _, enum := range f.Attr.EnumValues {
+			if val, err := strconv.ParseFloat(enum, 64); err == nil && val == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatClientValue converts value of the scalar type to string the way validator parses it
+func formatClientValue(filedType string, typeName string, value string) string {
+	scalar := scalarTypes[filedType]
+	switch scalar.kind {
+	case "bool":
+		return "strconv.FormatBool(" + value + ")"
+	case "int":
+		return "strconv.FormatInt(int64(" + value + "), 10)"
+	case "uint":
+		return "strconv.FormatUint(uint64(" + value + "), 10)"
+	case "float":
+		return "strconv.FormatFloat(float64(" + value + "), 'g', -1, " + strconv.Itoa(scalar.bits) + ")"
+	}
+	// named string types are converted too
+	if typeName != filedType {
+		return "string(" + value + ")"
+	}
+	return value
+}
+
+// clientTypeDecls returns params and result types with all types they refer to,
+// and imports of packages used by them
+func (m *Model) clientTypeDecls() ([]*ast.TypeSpec, []string, error) {
+	needed := make(map[string]bool)
+	queue := []string{}
+	for _, val := range m.endpoints() {
+		queue = append(queue, val.InputBusinessParamName, val.OutputBusinessParamName)
+	}
+	packages := make(map[string]bool)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		// imported types are used as they are
+		if needed[name] || name == "ApiError" || strings.Contains(name, ".") {
+			continue
+		}
+		spec, ok := m.typeSpecs[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("type %s is not declared in the parsed package", name)
+		}
+		needed[name] = true
+		ast.Inspect(spec.Type, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if pkg, ok := n.X.(*ast.Ident); ok {
+					packages[pkg.Name] = true
+				}
+				return false
+			case *ast.Ident:
+				if _, ok := m.typeSpecs[n.Name]; ok {
+					queue = append(queue, n.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	// keep the order of declarations in the source
+	specs := []*ast.TypeSpec{}
+	for _, node := range m.files {
+		for _, decl := range node.Decls {
+			g, ok := decl.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range g.Specs {
+				if spec := spec.(*ast.TypeSpec); needed[spec.Name.Name] {
+					specs = append(specs, spec)
+				}
+			}
+		}
+	}
+
+	// package names are resolved with imports of all files, the same import may be in several of them
+	imports := []string{}
+	for _, node := range m.files {
+		for _, imp := range node.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if !packages[name] {
+				continue
+			}
+			spec := imp.Path.Value
+			if imp.Name != nil {
+				spec = imp.Name.Name + " " + imp.Path.Value
+			} else if clientImports[path] {
+				continue
+			}
+			if !containsString(imports, spec) {
+				imports = append(imports, spec)
+			}
+		}
+	}
+	return specs, imports, nil
+}
+
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
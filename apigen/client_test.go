@@ -0,0 +1,80 @@
+package apigen
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClientZeroValues(t *testing.T) {
+	dir := writePackage(t, map[string]string{"api.go": fixtureHeader + `
+type Q struct {
+	Active bool    ` + "`apivalidator:\"default=true\"`" + `
+	Count  int     ` + "`apivalidator:\"required\"`" + `
+	Ratio  float64 ` + "`apivalidator:\"default=0.5\"`" + `
+	Limit  int     ` + "`apivalidator:\"default=0\"`" + `
+	Page   uint    ` + "`apivalidator:\"default=1,min=1\"`" + `
+	Kind   int     ` + "`apivalidator:\"default=2,enum=1|2\"`" + `
+	Name   string  ` + "`apivalidator:\"default=bob\"`" + `
+}
+
+// apigen:api {"url": "/q"}
+func (s *S) Query(ctx context.Context, in Q) (*R, error) { return nil, nil }
+`})
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	handlers, client := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := Generate(m, handlers, Options{}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if err := Generate(m, client, Options{Output: Client}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	out := client.String()
+	// нули обязательных полей и допустимые нули полей с ненулевым значением по умолчанию отправляются всегда
+	for _, text := range []string{
+		"\n\tparams.Set(\"active\", strconv.FormatBool(in.Active))\n",
+		"\n\tparams.Set(\"count\", strconv.FormatInt(int64(in.Count), 10))\n",
+		"\n\tparams.Set(\"ratio\", strconv.FormatFloat(float64(in.Ratio), 'g', -1, 64))\n",
+		"\n\tif in.Limit != 0 {\n\t\tparams.Set(\"limit\", ",
+		"\n\tif in.Page != 0 {\n\t\tparams.Set(\"page\", ",
+		"\n\tif in.Kind != 0 {\n\t\tparams.Set(\"kind\", ",
+		"\n\tif in.Name != \"\" {\n\t\tparams.Set(\"name\", in.Name)\n",
+	} {
+		if !strings.Contains(out, text) {
+			t.Errorf("client has no %q", text)
+		}
+	}
+	typeCheckGenerated(t, dir, out, handlers.String())
+}
+
+func TestClientTemplates(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"client.tmpl": strings.Replace(clientTemplate, "calls {{.Receiver}} endpoints over http", "is the custom client of {{.Receiver}}", 1),
+	})
+	m, err := Load(filepath.Join("testdata", "users"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	// имена заголовка и полей конверта берутся из конфигурации
+	m.Config.AuthHeader = "Authorization"
+	m.Config.Envelope.Error = "message"
+	buf := &bytes.Buffer{}
+	if err := Generate(m, buf, Options{Output: Client, ClientPackage: "usersclient", Templates: dir}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	out := buf.String()
+	for _, text := range []string{
+		"// UserApiClient is the custom client of UserApi",
+		`req.Header.Set("Authorization", token)`,
+		"`json:\"message\"`",
+		"// Token is sent in Authorization header to endpoints with auth",
+	} {
+		if !strings.Contains(out, text) {
+			t.Errorf("client has no %q", text)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package apigen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigNames are looked up in the package directory and its parents, the first found is used
+var ConfigNames = []string{"apigen.yaml", "apigen.yml", "apigen.json"}
+
+// Config holds project defaults, annotations override them for the endpoint
+type Config struct {
+	// AuthHeader carries the token of the caller, the client sends it and OpenAPI documents it
+	AuthHeader string `json:"authHeader"`
+	// Method is the method of endpoints without one in the annotation, any method is accepted when empty
+	Method string `json:"method"`
+	Auth   bool   `json:"auth"`
+	// CollectErrors reports all invalid parameters at once
+	CollectErrors bool           `json:"collectErrors"`
+	Envelope      EnvelopeConfig `json:"envelope"`
+}
+
+// EnvelopeConfig names fields of DefaultResponseWrapper in JSON responses
+type EnvelopeConfig struct {
+	Error    string `json:"error"`
+	Response string `json:"response"`
+	Fields   string `json:"fields"`
+}
+
+// DefaultConfig is used when the package has no configuration file
+func DefaultConfig() *Config {
+	return &Config{
+		AuthHeader: "X-Auth",
+		Envelope: EnvelopeConfig{
+			Error:    "error",
+			Response: "response",
+			Fields:   "fields",
+		},
+	}
+}
+
+// FindConfig returns the path of the configuration file of the directory, search stops
+// at the root of the module, empty path means there is no configuration
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range ConfigNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads the configuration over defaults, fields not set in the file keep default values,
+// empty path returns defaults
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".json" {
+		// yaml is converted to json, so both formats are checked the same way
+		doc, err := decodeYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	if cfg.AuthHeader == "" {
+		return nil, fmt.Errorf("%s: authHeader must not be empty", path)
+	}
+	if cfg.Envelope.Error == "" || cfg.Envelope.Response == "" || cfg.Envelope.Fields == "" {
+		return nil, fmt.Errorf("%s: envelope field names must not be empty", path)
+	}
+	return cfg, nil
+}
+
+// seed returns the description of the endpoint before its annotation is applied
+func (cfg *Config) seed() FuncGeneratorDescription {
+	return FuncGeneratorDescription{
+		Methods:       cfg.methods(),
+		Auth:          cfg.Auth,
+		CollectErrors: cfg.CollectErrors,
+	}
+}
+
+func (cfg *Config) methods() MethodList {
+	if cfg.Method == "" {
+		return nil
+	}
+	return MethodList{cfg.Method}
+}
+
+// YAML renders the configuration the way it is written in apigen.yaml
+func (cfg *Config) YAML() []byte {
+	return encodeYAML(yamlMap{}.
+		with("authHeader", cfg.AuthHeader).
+		with("method", cfg.Method).
+		with("auth", cfg.Auth).
+		with("collectErrors", cfg.CollectErrors).
+		with("envelope", yamlMap{}.
+			with("error", cfg.Envelope.Error).
+			with("response", cfg.Envelope.Response).
+			with("fields", cfg.Envelope.Fields)))
+}
@@ -0,0 +1,124 @@
+package apigen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindConfig(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"go.mod":      "module fixture\n",
+		"apigen.json": `{"auth": true}`,
+	})
+	for _, dir := range []string{"sub/pkg", "other/pkg", "nested"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, text := range map[string]string{
+		"sub/apigen.yaml": "auth: false\n",
+		"sub/apigen.json": "{}",
+		"nested/go.mod":   "module nested\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		dir      string
+		expected string
+	}{
+		// ближайший каталог, yaml раньше json
+		{"sub/pkg", "sub/apigen.yaml"},
+		{"sub", "sub/apigen.yaml"},
+		{"other/pkg", "apigen.json"},
+		// поиск останавливается в корне модуля
+		{"nested", ""},
+	}
+	for _, item := range cases {
+		got, err := FindConfig(filepath.Join(root, item.dir))
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", item.dir, err)
+			continue
+		}
+		if item.expected != "" {
+			item.expected = filepath.Join(root, item.expected)
+		}
+		if got != item.expected {
+			t.Errorf("[%s] expected %q, got %q", item.dir, item.expected, got)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"apigen.yaml":   "authHeader: Authorization\nmethod: post\nenvelope:\n  error: message\n",
+		"unknown.yaml":  "authHeaders: X-Token\n",
+		"envelope.json": `{"envelope": {"fields": ""}}`,
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "apigen.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// поля файла заменяют значения по умолчанию, остальные сохраняются
+	expected := DefaultConfig()
+	expected.AuthHeader = "Authorization"
+	expected.Method = "POST"
+	expected.Envelope.Error = "message"
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("unexpected config\nGot: %#v\nExpected: %#v", cfg, expected)
+	}
+
+	if cfg, err := LoadConfig(""); err != nil || !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("expected defaults without the file, got %#v, %v", cfg, err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "unknown.yaml")); err == nil || !strings.Contains(err.Error(), `unknown field "authHeaders"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "envelope.json")); err == nil || !strings.Contains(err.Error(), "envelope field names must not be empty") {
+		t.Errorf("expected envelope error, got %v", err)
+	}
+}
+
+func TestConfigOverride(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"apigen.yaml": "auth: true\nmethod: POST\n",
+		"auth.go":     authFixture,
+		"api.go": fixtureHeader + `
+// apigen:api {"url": "/defaults"}
+func (s *S) Defaults(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/annotated", "auth": false, "method": "GET"}
+func (s *S) Annotated(ctx context.Context, in P) (*R, error) { return nil, nil }
+`,
+	})
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	got := []string{}
+	for _, val := range m.Receiver("S").Endpoints {
+		got = append(got, val.FuncName+" "+strings.Join(val.Methods, ",")+" "+map[bool]string{true: "auth", false: "public"}[val.Auth])
+	}
+	// аннотация важнее конфигурации
+	expected := []string{"Defaults POST auth", "Annotated GET public"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected endpoints\nGot: %#v\nExpected: %#v", got, expected)
+	}
+
+	// конфигурация из LoadOptions заменяет файл пакета
+	m, err = LoadWithOptions(dir, LoadOptions{Config: DefaultConfig()})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if val := m.Receiver("S").Endpoints[0]; val.Auth || len(val.Methods) != 0 {
+		t.Errorf("unexpected endpoint with default config %#v", val)
+	}
+}
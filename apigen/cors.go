@@ -0,0 +1,141 @@
+package apigen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// checkCORS verifies CORS of the annotation, nil is valid
+func checkCORS(cors *CORSConfig) error {
+	if cors == nil {
+		return nil
+	}
+	if len(cors.Origins) == 0 {
+		return errors.New("cors needs origins")
+	}
+	for _, origin := range cors.Origins {
+		if origin == "*" && cors.Credentials {
+			return errors.New("cors credentials can not be allowed for origin *")
+		}
+		if origin != "*" && (origin == "" || strings.HasSuffix(origin, "/")) {
+			return fmt.Errorf("cors origin %q must be * or scheme://host[:port]", origin)
+		}
+	}
+	if cors.MaxAge < 0 {
+		return errors.New("cors maxage must not be negative")
+	}
+	return nil
+}
+
+// corsVar names the variable with CORS of the endpoint, empty without CORS
+func corsVar(val FuncGeneratorDescription) string {
+	if val.CORS == nil {
+		return ""
+	}
+	return "apigenCORS" + val.ReceiverTypeName + val.FuncName
+}
+
+func (m *Model) hasCORS() bool {
+	for _, val := range m.endpoints() {
+		if val.CORS != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHelpers answer preflight requests and allow origins of actual requests, data is []corsData
+const corsHelpers = `// apigenCORS holds CORS of the endpoint
+type apigenCORS struct {
+	origins     []string
+	headers     string
+	credentials bool
+	maxAge      string
+}
+
+// apigenIsPreflight tells preflight requests from OPTIONS requests of endpoints
+func apigenIsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowOrigin sets Access-Control-Allow-Origin when the origin of the request is allowed
+func (c *apigenCORS) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	for _, allowed := range c.origins {
+		if allowed != "*" && allowed != origin {
+			continue
+		}
+		// credentials are never allowed with *, it is checked with annotations
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if c.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		return true
+	}
+	return false
+}
+
+// preflight answers the preflight request, methods are allowed methods of the endpoint,
+// the requested method when it accepts any
+func (c *apigenCORS) preflight(w http.ResponseWriter, r *http.Request, methods string) {
+	if c.allowOrigin(w, r) {
+		if methods == "" {
+			methods = r.Header.Get("Access-Control-Request-Method")
+		}
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		if c.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", c.maxAge)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+{{- range .}}
+
+var {{.Var}} = &apigenCORS{
+	origins:     []string{ {{- quoteList .Origins -}} },
+	headers:     {{quote .Headers}},
+	credentials: {{.Credentials}},
+{{- if .MaxAge}}
+	maxAge:      {{quote .MaxAge}},
+{{- end}}
+}
+{{- end}}
+`
+
+// corsData is CORS of the endpoint in the corsHelpers template
+type corsData struct {
+	// Var names the variable of the endpoint
+	Var     string
+	Origins []string
+	// Headers and MaxAge are values of preflight responses, MaxAge is empty without it
+	Headers     string
+	Credentials bool
+	MaxAge      string
+}
+
+// cors returns CORS of endpoints having it
+func (m *Model) cors() []corsData {
+	res := []corsData{}
+	for _, val := range m.endpoints() {
+		if val.CORS == nil {
+			continue
+		}
+		headers := val.CORS.Headers
+		if len(headers) == 0 {
+			headers = []string{"Content-Type", m.Config.AuthHeader}
+		}
+		cors := corsData{Var: corsVar(val), Origins: val.CORS.Origins, Headers: strings.Join(headers, ", "), Credentials: val.CORS.Credentials}
+		if val.CORS.MaxAge > 0 {
+			cors.MaxAge = strconv.Itoa(val.CORS.MaxAge)
+		}
+		res = append(res, cors)
+	}
+	return res
+}
@@ -0,0 +1,74 @@
+package apigen
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"sort"
+)
+
+// Error is a problem found in the loaded package
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList holds every problem of the package sorted by position, so all of them are reported at once
+type ErrorList []Error
+
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+}
+
+// diagnostics collects problems while the package is loaded
+type diagnostics struct {
+	fset *token.FileSet
+	list ErrorList
+}
+
+func (d *diagnostics) errorf(pos token.Pos, format string, args ...interface{}) {
+	d.list = append(d.list, Error{d.fset.Position(pos), fmt.Sprintf(format, args...)})
+}
+
+// addParseError keeps positions of syntax errors reported by the parser
+func (d *diagnostics) addParseError(err error) {
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		d.list = append(d.list, Error{Msg: err.Error()})
+		return
+	}
+	for _, e := range list {
+		d.list = append(d.list, Error{e.Pos, e.Msg})
+	}
+}
+
+// err returns collected problems sorted by position, nil if there are none
+func (d *diagnostics) err() error {
+	if len(d.list) == 0 {
+		return nil
+	}
+	sort.SliceStable(d.list, func(i, j int) bool {
+		a, b := d.list[i].Pos, d.list[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return d.list
+}
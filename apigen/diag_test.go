@@ -0,0 +1,115 @@
+package apigen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixtureHeader declares ApiError and types used by endpoints of test packages
+const fixtureHeader = `package fixture
+
+import "context"
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string { return ae.Err.Error() }
+
+type S struct{}
+
+type P struct {
+	Name string ` + "`apivalidator:\"required\"`" + `
+}
+
+type R struct{ Name string }
+
+var _ = context.Background
+`
+
+// authFixture declares receiver U authenticating callers and Authenticate of S
+const authFixture = `package fixture
+
+import (
+	"context"
+	"net/http"
+)
+
+type U struct{}
+
+func (u *U) Authenticate(r *http.Request) (context.Context, error) { return nil, nil }
+
+func (s *S) Authenticate(r *http.Request) (context.Context, error) { return nil, nil }
+`
+
+// writePackage writes files to a new directory and returns it
+func writePackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPositionedErrors(t *testing.T) {
+	dir := writePackage(t, map[string]string{"api.go": fixtureHeader + `
+type Bad struct {
+	Age int ` + "`apivalidator:\"min=abc\"`" + `
+}
+
+// apigen:api {"url": "/broken",
+func (s *S) Broken(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/tag"}
+func (s *S) Tag(ctx context.Context, in Bad) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/private", "auth": true}
+func (t *T) Private(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/admin", "roles": ["admin"]}
+func (u *U) Admin(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+type T struct{}
+`, "auth.go": authFixture})
+
+	_, err := Load(dir)
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected ErrorList, got %#v", err)
+	}
+	got := []string{}
+	for _, e := range list {
+		rel, _ := filepath.Rel(dir, e.Pos.Filename)
+		e.Pos.Filename = rel
+		got = append(got, e.Error())
+	}
+	// ошибки отсортированы по позиции
+	expected := []string{
+		"api.go:23:2: field Bad.Age: apivalidator: bad min=abc, number expected",
+		"api.go:26:1: apigen:api: invalid JSON: unexpected end of JSON input",
+		"api.go:32:1: method Private: auth needs method Authenticate(r *http.Request) (context.Context, error) of *T",
+		"api.go:35:1: method Admin: roles needs method Roles(ctx context.Context) ([]string, error) of *U",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected errors\nGot: %#v\nExpected: %#v", got, expected)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	dir := writePackage(t, map[string]string{"api.go": "package fixture\n\nfunc (\n"})
+
+	_, err := Load(dir)
+	list, ok := err.(ErrorList)
+	if !ok || len(list) == 0 {
+		t.Fatalf("expected ErrorList, got %#v", err)
+	}
+	if pos := list[0].Pos; filepath.Base(pos.Filename) != "api.go" || pos.Line != 3 || pos.Column != 8 {
+		t.Errorf("unexpected position of the syntax error %v", pos)
+	}
+}
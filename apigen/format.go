@@ -0,0 +1,94 @@
+package apigen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// generatedHeader marks outputs as generated for go tools, linters and loadPackage
+const generatedHeader = "// Code generated by apigen. DO NOT EDIT."
+
+// formatGenerated writes the header, the package clause and imports used by the body,
+// and formats the result with gofmt, imports are quoted paths optionally preceded by the name
+func (m *Model) formatGenerated(pkgName string, imports []string, body []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", append([]byte("package "+pkgName+"\n"), body...), 0)
+	if err != nil {
+		return nil, fmt.Errorf("generated code is invalid: %v", err)
+	}
+	// package names are the only unresolved identifiers selected from
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	std, other := []string{}, []string{}
+	for _, spec := range imports {
+		name, path := m.importName(spec)
+		if !used[name] || containsString(std, spec) || containsString(other, spec) {
+			continue
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Slice(std, func(i, j int) bool { return importPath(std[i]) < importPath(std[j]) })
+	sort.Slice(other, func(i, j int) bool { return importPath(other[i]) < importPath(other[j]) })
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, generatedHeader)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package "+pkgName)
+	fmt.Fprintln(buf)
+	if len(std)+len(other) > 0 {
+		fmt.Fprintln(buf, "import (")
+		for _, spec := range std {
+			fmt.Fprintln(buf, "\t"+spec)
+		}
+		if len(std) > 0 && len(other) > 0 {
+			fmt.Fprintln(buf)
+		}
+		for _, spec := range other {
+			fmt.Fprintln(buf, "\t"+spec)
+		}
+		fmt.Fprintln(buf, ")")
+		fmt.Fprintln(buf)
+	}
+	buf.Write(body)
+	return format.Source(buf.Bytes())
+}
+
+// importName returns the name the import is referred by and its path
+func (m *Model) importName(spec string) (string, string) {
+	path := importPath(spec)
+	if idx := strings.Index(spec, " "); idx != -1 {
+		return spec[:idx], path
+	}
+	// packages of parameters and results are known by the type checker
+	if name, ok := m.paramImports[path]; ok {
+		return name, path
+	}
+	if name, ok := m.resultImports[path]; ok {
+		return name, path
+	}
+	return path[strings.LastIndex(path, "/")+1:], path
+}
+
+func importPath(spec string) string {
+	path, _ := strconv.Unquote(spec[strings.Index(spec, `"`):])
+	return path
+}
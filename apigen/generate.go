@@ -0,0 +1,163 @@
+package apigen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// Output selects what Generate writes
+type Output int
+
+const (
+	// Handlers are ServeHTTP of receivers, wrappers of endpoints and validators of parameters
+	Handlers Output = iota
+	// Client is typed http client of every receiver
+	Client
+	// OpenAPI is OpenAPI 3.1 document in YAML
+	OpenAPI
+)
+
+// Options of the generated output
+type Options struct {
+	Output Output
+	// Templates is the directory with <name>.tmpl files of TemplateNames
+	// replacing built-in templates of handlers and clients
+	Templates string
+	// Router adds NewRouter composing all receivers under their prefixes to handlers,
+	// urls served by more than one receiver are returned as ErrorList
+	Router bool
+	// CollectErrors reports all invalid parameters at once for every endpoint
+	CollectErrors bool
+	// ClientPackage is the package of the client, the package of handlers when empty,
+	// client in other package gets copies of parameters and result types
+	ClientPackage string
+}
+
+// Generate writes the output for the model
+func Generate(m *Model, w io.Writer, opts Options) error {
+	switch opts.Output {
+	case Handlers:
+		if opts.Router {
+			if err := m.checkRouter(); err != nil {
+				return err
+			}
+		}
+		tmpl, err := loadTemplates(opts.Templates)
+		if err != nil {
+			return err
+		}
+		return m.writeHandlers(w, tmpl, opts)
+	case Client:
+		tmpl, err := loadTemplates(opts.Templates)
+		if err != nil {
+			return err
+		}
+		pkgName := opts.ClientPackage
+		if pkgName == "" {
+			pkgName = m.Package
+		}
+		return m.writeClient(w, tmpl, pkgName)
+	case OpenAPI:
+		doc, err := m.buildOpenAPI()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(encodeYAML(doc))
+		return err
+	}
+	return fmt.Errorf("unknown output %d", opts.Output)
+}
+
+// writeHandlers writes ServeHTTP, wrappers and validators of all receivers
+func (m *Model) writeHandlers(w io.Writer, tmpl *template.Template, opts Options) error {
+	out := &bytes.Buffer{}
+	if err := executeTemplate(out, tmpl, "envelope", m.Config.Envelope); err != nil {
+		return err
+	}
+
+	// helpers are written in the order of TemplateNames when endpoints use them
+	helpers := []struct {
+		name string
+		used bool
+		data interface{}
+	}{
+		{"authHelpers", m.hasAuth() || m.hasAuthorization(), m.auth()},
+		{"pathParamsHelpers", m.hasURLTemplates(), nil},
+		{"paramsHelpers", true, nil},
+		{"sliceParamsHelpers", m.hasSliceParams(), nil},
+		{"panicHelpers", true, nil},
+		{"rateLimitHelpers", m.hasRateLimits(), nil},
+		{"corsHelpers", m.hasCORS(), m.cors()},
+	}
+	for _, helper := range helpers {
+		if !helper.used {
+			continue
+		}
+		if err := executeTemplate(out, tmpl, helper.name, helper.data); err != nil {
+			return err
+		}
+	}
+
+	if err := executeTemplate(out, tmpl, "options", optionsData{RateLimits: m.hasRateLimits()}); err != nil {
+		return err
+	}
+	if err := m.prepeareServeHttpFuncForStructs(out, tmpl, opts); err != nil {
+		return err
+	}
+
+	if opts.Router {
+		if err := executeTemplate(out, tmpl, "mux", m.mux()); err != nil {
+			return err
+		}
+	}
+
+	// generate validation function for params with validate fields
+	for _, ps := range m.Params {
+		if err := executeTemplate(out, tmpl, "validator", ps); err != nil {
+			return err
+		}
+	}
+
+	// unused imports are dropped by formatGenerated
+	imports := []string{`"context"`, `"crypto/sha256"`, `"encoding/hex"`, `"encoding/json"`, `"errors"`, `"fmt"`, `"io"`, `"mime"`, `"net"`, `"net/http"`, `"net/url"`, `"runtime/debug"`, `"strconv"`, `"strings"`, `"sync"`, `"time"`}
+	res, err := m.formatGenerated(m.Package, append(imports, sortedImports(m.paramImports)...), out.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res)
+	return err
+}
+
+func (m *Model) hasAuth() bool {
+	for _, val := range m.endpoints() {
+		if val.Auth {
+			return true
+		}
+	}
+	return false
+}
+
+// prepeareServeHttpFuncForStructs writes ServeHTTP and wrappers of every receiver
+func (m *Model) prepeareServeHttpFuncForStructs(out io.Writer, tmpl *template.Template, opts Options) error {
+	for _, recv := range m.Receivers {
+		router := routerData{Receiver: recv.Name, Paths: recv.paths(), RateLimits: recv.hasRateLimits()}
+		if err := executeTemplate(out, tmpl, "router", router); err != nil {
+			return err
+		}
+		for _, val := range recv.Endpoints {
+			wrapper := wrapperData{
+				FuncGeneratorDescription: val,
+				ValidateCall:             m.ParamsOf(val).validateCall("inParam", val.CollectErrors || opts.CollectErrors),
+			}
+			if val.timeout > 0 {
+				wrapper.Timeout = durationExpr(val.timeout)
+			}
+			if err := executeTemplate(out, tmpl, "wrapper", wrapper); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
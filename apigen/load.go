@@ -0,0 +1,166 @@
+package apigen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+)
+
+// LoadOptions change how the package is loaded
+type LoadOptions struct {
+	// Receivers limits the model to these receivers, all receivers with annotated methods by default
+	Receivers []string
+	// Tags are build tags used to select files of the package
+	Tags []string
+	// Skip lists files which are not parsed, usually previous outputs that may be stale
+	Skip []string
+	// Config is used instead of the configuration file of the package
+	Config *Config
+}
+
+// Load parses and type checks the package in the directory, or in the directory of the file,
+// problems of annotated methods are returned as ErrorList
+func Load(path string) (*Model, error) {
+	return LoadWithOptions(path, LoadOptions{})
+}
+
+// LoadWithOptions is Load with options
+func LoadWithOptions(path string, opts LoadOptions) (*Model, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		configPath, err := FindConfig(PackageDir(path))
+		if err != nil {
+			return nil, err
+		}
+		if cfg, err = LoadConfig(configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	fset := token.NewFileSet()
+	d := &diagnostics{fset: fset}
+	files, err := loadPackage(fset, d, path, opts.Tags, opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.err(); err != nil {
+		return nil, err
+	}
+	m := &Model{
+		Package:       files[0].Name.Name,
+		Dir:           PackageDir(path),
+		Config:        cfg,
+		fset:          fset,
+		files:         files,
+		receivers:     make(map[string]*Receiver),
+		typeSpecs:     make(map[string]*ast.TypeSpec),
+		annotations:   make(map[string]receiverAnnotation),
+		params:        make(map[string]*ParamsStruct),
+		paramImports:  make(map[string]string),
+		resultImports: make(map[string]string),
+	}
+
+	for _, node := range files {
+		m.collectTypeSpecs(node)
+		m.collectReceiverAnnotations(d, node)
+	}
+	pkg, info := checkPackage(fset, d, m.Dir, opts.Tags, files)
+	var only map[string]bool
+	if len(opts.Receivers) > 0 {
+		only = make(map[string]bool)
+		for _, name := range opts.Receivers {
+			only[name] = true
+		}
+	}
+	for _, node := range files {
+		m.collectFuncDescriptions(d, pkg, info, node, only)
+	}
+	m.checkRoutes(d)
+	if err := d.err(); err != nil {
+		return nil, err
+	}
+	for _, name := range opts.Receivers {
+		if m.Receiver(name) == nil {
+			return nil, fmt.Errorf("receiver %s has no methods annotated with apigen:api", name)
+		}
+	}
+	return m, nil
+}
+
+// loadPackage parses every go file of the package in the directory, or in the directory of the file,
+// outputs of apigen and files listed in skip are left out, syntax errors are added to diagnostics
+func loadPackage(fset *token.FileSet, d *diagnostics, path string, tags []string, skip []string) ([]*ast.File, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	dir := PackageDir(path)
+
+	ctxt := build.Default
+	ctxt.BuildTags = tags
+	pkg, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		if abs, err := filepath.Abs(name); err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	files := []*ast.File{}
+	for _, name := range pkg.GoFiles {
+		filename := filepath.Join(dir, name)
+		if abs, err := filepath.Abs(filename); err == nil && skipped[abs] {
+			continue
+		}
+		// header is checked first, stale generated files may not parse at all
+		header, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			d.addParseError(err)
+			continue
+		}
+		if isGeneratedFile(header) {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+		if err != nil {
+			d.addParseError(err)
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 && len(d.list) == 0 {
+		return nil, fmt.Errorf("no go files to parse in %s", dir)
+	}
+	return files, nil
+}
+
+// PackageDir returns the directory itself or the directory of the file
+func PackageDir(path string) string {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// isGeneratedFile reports whether the file was written by apigen, files of other generators
+// may declare parameters and results of endpoints
+func isGeneratedFile(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if comment.Text == generatedHeader || comment.Text == "// DO NOT CHANGE" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package apigen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// twoReceivers adds receiver T to the fixture
+const twoReceivers = fixtureHeader + `
+// apigen:api {"url": "/s"}
+func (s *S) Get(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+type T struct{}
+
+// apigen:api {"url": "/t"}
+func (t *T) Get(ctx context.Context, in P) (*R, error) { return nil, nil }
+`
+
+func receiverNames(m *Model) []string {
+	names := []string{}
+	for _, recv := range m.Receivers {
+		names = append(names, recv.Name)
+	}
+	return names
+}
+
+// generatedFset and generatedImporter are shared by type checks of outputs, so imported packages are checked once
+var (
+	generatedFset     = token.NewFileSet()
+	generatedImporter = newSourceImporter(generatedFset, ".", nil)
+)
+
+// typeCheckGenerated type checks outputs of one package together with its go files in dir,
+// outputs of another package are checked alone
+func typeCheckGenerated(t *testing.T, dir string, outs ...string) {
+	t.Helper()
+	files := []*ast.File{}
+	for i, out := range outs {
+		file, err := parser.ParseFile(generatedFset, filepath.Join(dir, fmt.Sprintf("apigen_out%d.go", i)), out, 0)
+		if err != nil {
+			t.Errorf("output does not parse: %v", err)
+			return
+		}
+		files = append(files, file)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, name := range names {
+		file, err := parser.ParseFile(generatedFset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name.Name == files[0].Name.Name {
+			files = append(files, file)
+		}
+	}
+	conf := types.Config{
+		Importer: generatedImporter,
+		Error: func(err error) {
+			t.Errorf("output does not compile: %v", err)
+		},
+	}
+	conf.Check(files[0].Name.Name, generatedFset, files, nil)
+}
+
+func TestLoad(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"api.go": twoReceivers,
+		// сгенерированные и пропущенные файлы не разбираются
+		"api_apigen.go": "// Code generated by apigen. DO NOT EDIT.\n\npackage fixture\n\nfunc (",
+		"stale.go":      "package fixture\n\nfunc (",
+		// файл другой сборки
+		"tagged.go": "//go:build extra\n\npackage fixture\n\nimport \"context\"\n\ntype U struct{}\n\n// apigen:api {\"url\": \"/u\"}\nfunc (u *U) Get(ctx context.Context, in P) (*R, error) { return nil, nil }\n",
+	})
+	stale := filepath.Join(dir, "stale.go")
+
+	m, err := LoadWithOptions(filepath.Join(dir, "api.go"), LoadOptions{Skip: []string{stale}})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if m.Package != "fixture" || m.Dir != dir || strings.Join(receiverNames(m), ",") != "S,T" {
+		t.Errorf("unexpected model %s %s %v", m.Package, m.Dir, receiverNames(m))
+	}
+	if m.ParamsOf(m.Receiver("T").Endpoints[0]).TypeName != "P" {
+		t.Errorf("unexpected params of T.Get")
+	}
+
+	m, err = LoadWithOptions(dir, LoadOptions{Skip: []string{stale}, Receivers: []string{"T"}})
+	if err != nil || strings.Join(receiverNames(m), ",") != "T" {
+		t.Errorf("expected only T, got %v, %v", m, err)
+	}
+	m, err = LoadWithOptions(dir, LoadOptions{Skip: []string{stale}, Tags: []string{"extra"}})
+	if err != nil || strings.Join(receiverNames(m), ",") != "S,T,U" {
+		t.Errorf("expected U with the tag, got %v, %v", m, err)
+	}
+
+	if _, err := LoadWithOptions(dir, LoadOptions{Skip: []string{stale}, Receivers: []string{"V"}}); err == nil || err.Error() != "receiver V has no methods annotated with apigen:api" {
+		t.Errorf("unexpected error of unknown receiver: %v", err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "stale.go:3:7") {
+		t.Errorf("expected syntax error of stale.go, got %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error of missing path")
+	}
+}
+
+func TestLoadOtherGenerators(t *testing.T) {
+	// параметры и результат объявлены в файле другого генератора
+	dir := writePackage(t, map[string]string{
+		"api.go":      "package fixture\n\nimport \"context\"\n\ntype S struct{}\n\n// apigen:api {\"url\": \"/s\"}\nfunc (s *S) Get(ctx context.Context, in P) (*R, error) { return nil, nil }\n",
+		"types.pb.go": "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage fixture\n\ntype P struct {\n\tName string `apivalidator:\"required\"`\n}\n\ntype R struct {\n\tID int `json:\"id\"`\n}\n",
+		// устаревший заголовок apigen
+		"api_handlers.go": "// DO NOT CHANGE\n\npackage fixture\n\nfunc (",
+	})
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if m.ParamsOf(m.Receiver("S").Endpoints[0]).TypeName != "P" {
+		t.Errorf("unexpected params of S.Get")
+	}
+}
+
+func TestLoadModuleImports(t *testing.T) {
+	// модуль пакета не совпадает с модулем рабочего каталога теста
+	t.Setenv("GOPROXY", "off")
+	api := "package fixture\n\nimport (\n\t\"context\"\n\n\t\"example.com/fixture/types\"\n)\n\ntype S struct{}\n\ntype P struct {\n\tName string `apivalidator:\"required\"`\n}\n\n// apigen:api {\"url\": \"/s\"}\nfunc (s *S) Get(ctx context.Context, in P) (*types.User, error) { return nil, nil }\n"
+	dir := writePackage(t, map[string]string{
+		"go.mod": "module example.com/fixture\n\ngo 1.22\n",
+		"api.go": api,
+	})
+	if err := os.Mkdir(filepath.Join(dir, "types"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "types", "types.go"), []byte("package types\n\ntype User struct {\n\tEmail string `json:\"email\"`\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	doc := &bytes.Buffer{}
+	if err := Generate(m, doc, Options{Output: OpenAPI}); err != nil || !strings.Contains(doc.String(), "email:") {
+		t.Errorf("expected email of types.User, got %v\n%s", err, doc)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "api.go"), []byte(strings.Replace(api, "fixture/types", "fixture/missing", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(dir)
+	list, ok := err.(ErrorList)
+	if !ok || len(list) == 0 || list[0].Pos.Line != 6 || !strings.HasPrefix(list[0].Msg, "could not import example.com/fixture/missing") {
+		t.Errorf("expected the import error at its position, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writePackage(t, map[string]string{"api.go": twoReceivers})
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{"handlers", Options{}, []string{"func NewSHandler(srv *S, opts ...Option) *SHandler {", "func (srv *T) WrapGet("}},
+		{"router", Options{Router: true}, []string{"func NewRouter(s *S, t *T, opts ...Option) *Router {"}},
+		{"client", Options{Output: Client}, []string{"func NewSClient(", "func (c *TClient) Get(ctx context.Context, in P) (*R, error) {"}},
+		{"client package", Options{Output: Client, ClientPackage: "fixtureclient"}, []string{"package fixtureclient", "type P struct {"}},
+		{"openapi", Options{Output: OpenAPI}, []string{"openapi: 3.1.0", "  /s:", "  /t:"}},
+	}
+	// client of the package uses declarations of handlers
+	handlers := ""
+	for _, item := range cases {
+		buf := &bytes.Buffer{}
+		if err := Generate(m, buf, item.opts); err != nil {
+			t.Errorf("[%s] generate: %v", item.name, err)
+			continue
+		}
+		out := buf.String()
+		for _, text := range item.expected {
+			if !strings.Contains(out, text) {
+				t.Errorf("[%s] output has no %q", item.name, text)
+			}
+		}
+		if item.opts.Output == OpenAPI {
+			continue
+		}
+		if !strings.HasPrefix(out, "// Code generated by apigen. DO NOT EDIT.") {
+			t.Errorf("[%s] output has no generated header", item.name)
+		}
+		switch {
+		case item.opts.Output == Handlers && !item.opts.Router:
+			handlers = out
+			typeCheckGenerated(t, dir, out)
+		case item.opts.Output == Client && item.opts.ClientPackage == "":
+			typeCheckGenerated(t, dir, out, handlers)
+		default:
+			typeCheckGenerated(t, dir, out)
+		}
+	}
+
+	if err := Generate(m, &bytes.Buffer{}, Options{Output: Output(7)}); err == nil || err.Error() != "unknown output 7" {
+		t.Errorf("unexpected error of unknown output: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package apigen generates http handlers, clients and OpenAPI documents
+// for methods annotated with apigen:api.
+//
+// Load parses and type checks the package into the Model, Generate writes
+// one of the outputs for it:
+//
+//	m, err := apigen.Load(".")
+//	if err != nil {
+//		return err
+//	}
+//	return apigen.Generate(m, w, apigen.Options{Output: apigen.Handlers})
+package apigen
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"time"
+)
+
+// Model is the annotated package as generators see it
+type Model struct {
+	// Package is the name of the package
+	Package string
+	// Dir is the directory of the package
+	Dir    string
+	Config *Config
+	// Receivers are in the order they are declared
+	Receivers []*Receiver
+	// Params are parameters of all endpoints in the order they were found
+	Params []*ParamsStruct
+
+	fset      *token.FileSet
+	files     []*ast.File
+	receivers map[string]*Receiver
+	// typeSpecs holds every type declared in the package, by name
+	typeSpecs map[string]*ast.TypeSpec
+	// annotations holds apigen:api of receiver types by name
+	annotations map[string]receiverAnnotation
+	// params holds Params by TypeName
+	params map[string]*ParamsStruct
+	// paramImports and resultImports map paths of packages referenced by parameters
+	// and by result types to their names
+	paramImports  map[string]string
+	resultImports map[string]string
+}
+
+// Receiver is a type with annotated methods, it gets ServeHTTP and a client
+type Receiver struct {
+	Name string
+	// Prefix is the path the receiver is mounted at by NewRouter
+	Prefix string
+	// Endpoints are in the order methods are declared
+	Endpoints []FuncGeneratorDescription
+}
+
+// FuncGeneratorDescription is an annotated method, fields with json tags come from apigen:api
+type FuncGeneratorDescription struct {
+	ReceiverTypeName        string `json:"-"`
+	InputBusinessParamName  string `json:"-"`
+	OutputBusinessParamName string `json:"-"`
+	FuncName                string `json:"-"`
+	resultType              types.Type
+	// pos is the position of the annotation
+	pos  token.Pos
+	Url  string `json:"url"`
+	Auth bool   `json:"auth"`
+	// Prefix mounts the receiver, all endpoints of the receiver and its type annotation must agree
+	Prefix string `json:"prefix"`
+	// Methods are accepted by the endpoint, any method when empty, GET implies HEAD
+	Methods MethodList `json:"method"`
+	// caller must have any of Roles and all of Scopes, both imply Auth
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes"`
+	// CollectErrors reports all invalid parameters at once instead of the first one
+	CollectErrors bool `json:"collecterrors"`
+	// Timeout is the deadline of the call like 2s, 504 is answered at the deadline while
+	// the method keeps running until it returns, timeout is parsed Timeout
+	Timeout string `json:"timeout"`
+	timeout time.Duration
+	// RateLimit is the token bucket of every caller like "10/s burst=20 key=auth", rateLimit is parsed RateLimit
+	RateLimit string `json:"ratelimit"`
+	rateLimit *rateLimit
+	// CORS replaces CORS of the receiver
+	CORS *CORSConfig `json:"cors"`
+}
+
+// CORSConfig lets browsers call endpoints from other origins
+type CORSConfig struct {
+	// Origins are allowed origins like https://example.com, * allows any origin
+	Origins []string `json:"origins"`
+	// Headers are allowed request headers, Content-Type and the auth header by default
+	Headers     []string `json:"headers"`
+	Credentials bool     `json:"credentials"`
+	// MaxAge is seconds browsers may cache the preflight response
+	MaxAge int `json:"maxage"`
+}
+
+// MethodList is "GET" or ["GET", "POST"] in the annotation, methods are uppercased
+type MethodList []string
+
+func (ml *MethodList) UnmarshalJSON(data []byte) error {
+	var list []string
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		if one != "" {
+			list = []string{one}
+		}
+	} else if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("method must be a string or a list of strings")
+	}
+	*ml = nil
+	for _, method := range list {
+		*ml = append(*ml, strings.ToUpper(method))
+	}
+	return nil
+}
+
+// Has reports whether the method is listed
+func (ml MethodList) Has(method string) bool {
+	for _, val := range ml {
+		if val == method {
+			return true
+		}
+	}
+	return false
+}
+
+// receiverAnnotation is apigen:api in the doc comment of the receiver type
+type receiverAnnotation struct {
+	Prefix string `json:"prefix"`
+	// CORS is used by endpoints without their own
+	CORS *CORSConfig `json:"cors"`
+}
+
+// ParamsStruct is the parameters struct of endpoints as the validator sees it
+type ParamsStruct struct {
+	// TypeName is go expression of the type in the generated package
+	TypeName string
+	// Local structs get validator methods, imported ones are validated by functions
+	Local        bool
+	ValidateFunc string
+	Fields       []ParamField
+	// valid is false when some fields can not be validated
+	valid bool
+}
+
+// ParamField is a field of parameters filled from the request
+type ParamField struct {
+	Name string
+	// TypeName and ElemTypeName are go expressions of the field type and of slice items
+	TypeName     string
+	ElemTypeName string
+	// Scalar is the underlying basic type of the field or of slice items
+	Scalar  string
+	IsSlice bool
+	Attr    ValidateAttr
+}
+
+// ValidateAttr is the parsed apivalidator tag
+type ValidateAttr struct {
+	ParamName    string
+	PathName     string
+	JSONName     string
+	IsRequired   bool
+	EnumValues   []string
+	DefaultValue string
+	Min          float64
+	Max          float64
+	HasMin       bool
+	HasMax       bool
+	// slice fields only
+	MinItems       int
+	MaxItems       int
+	HasMaxItems    bool
+	Unique         bool
+	CommaSeparated bool
+}
+
+// Receiver returns the receiver by name, nil if it has no annotated methods
+func (m *Model) Receiver(name string) *Receiver {
+	return m.receivers[name]
+}
+
+// ParamsOf returns parameters of the endpoint
+func (m *Model) ParamsOf(endpoint FuncGeneratorDescription) *ParamsStruct {
+	return m.params[endpoint.InputBusinessParamName]
+}
+
+// addEndpoint appends the endpoint to its receiver, receivers keep the order they were found
+func (m *Model) addEndpoint(desc FuncGeneratorDescription) {
+	recv, ok := m.receivers[desc.ReceiverTypeName]
+	if !ok {
+		recv = &Receiver{Name: desc.ReceiverTypeName, Prefix: m.annotations[desc.ReceiverTypeName].Prefix}
+		m.receivers[recv.Name] = recv
+		m.Receivers = append(m.Receivers, recv)
+	}
+	if recv.Prefix == "" {
+		recv.Prefix = desc.Prefix
+	}
+	recv.Endpoints = append(recv.Endpoints, desc)
+}
+
+// endpoints returns endpoints of all receivers
+func (m *Model) endpoints() []FuncGeneratorDescription {
+	res := []FuncGeneratorDescription{}
+	for _, recv := range m.Receivers {
+		res = append(res, recv.Endpoints...)
+	}
+	return res
+}
@@ -0,0 +1,541 @@
+package apigen
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	schemaRefPrefix    = "#/components/schemas/"
+	envelopeSchemaName = "DefaultResponseWrapper"
+	authSecurityScheme = "XAuth"
+)
+
+// openapiBuilder converts collected handlers descriptions into OpenAPI 3.1 document
+type openapiBuilder struct {
+	m       *Model
+	schemas yamlMap
+	// components are keyed by the type with its package path, taken lists their names
+	components map[string]string
+	taken      map[string]bool
+}
+
+func (m *Model) buildOpenAPI() (yamlMap, error) {
+	b := &openapiBuilder{m: m, components: make(map[string]string), taken: map[string]bool{envelopeSchemaName: true}}
+
+	paths := yamlMap{}
+	pathIdx := make(map[string]int)
+	owners := make(map[string]string)
+	hasAuth := false
+	for _, recv := range m.Receivers {
+		receiverName := recv.Name
+		for _, handler := range recv.Endpoints {
+			if handler.Auth {
+				hasAuth = true
+			}
+			docPath := openapiPath(recv.Prefix + handler.Url)
+			idx, ok := pathIdx[docPath]
+			if !ok {
+				idx = len(paths)
+				pathIdx[docPath] = idx
+				paths = paths.with(docPath, yamlMap{})
+			}
+			methods := documentedMethods(handler)
+			for _, method := range methods {
+				key := method + " " + docPath
+				if owner, ok := owners[key]; ok {
+					return nil, fmt.Errorf("%s %s is served by both %s and %s.%s, set prefix of the receivers or select them with -receivers",
+						strings.ToUpper(method), docPath, owner, receiverName, handler.FuncName)
+				}
+				owners[key] = receiverName + "." + handler.FuncName
+				operationID := handler.ReceiverTypeName + handler.FuncName
+				if len(methods) > 1 {
+					operationID += upperFirst(method)
+				}
+				operation, err := b.operation(handler, method, operationID)
+				if err != nil {
+					return nil, err
+				}
+				item := paths[idx].Value.(yamlMap)
+				paths[idx].Value = item.with(method, operation)
+			}
+		}
+	}
+
+	b.schemas = b.schemas.with(envelopeSchemaName, yamlMap{}.
+		with("type", "object").
+		with("required", []string{m.Config.Envelope.Error}).
+		with("properties", yamlMap{}.
+			with(m.Config.Envelope.Error, yamlMap{}.
+				with("type", "string").
+				with("description", "error message, empty on success")).
+			with(m.Config.Envelope.Response, yamlMap{}.
+				with("description", "result of the call, omitted on error")).
+			with(m.Config.Envelope.Fields, yamlMap{}.
+				with("type", "object").
+				with("additionalProperties", yamlMap{}.with("type", "string")).
+				with("description", "errors of invalid parameters, when all of them are collected"))))
+
+	components := yamlMap{}.with("schemas", b.schemas)
+	if hasAuth {
+		components = components.with("securitySchemes", yamlMap{}.
+			with(authSecurityScheme, yamlMap{}.
+				with("type", "apiKey").
+				with("in", "header").
+				with("name", m.Config.AuthHeader)))
+	}
+
+	doc := yamlMap{}.
+		with("openapi", "3.1.0").
+		with("info", yamlMap{}.
+			with("title", m.Package).
+			with("version", "1.0.0")).
+		with("paths", paths).
+		with("components", components)
+	return doc, nil
+}
+
+// documentedMethods returns lowercased HTTP methods handler accepts,
+// handlers without method accept anything, they are described as GET and POST
+func documentedMethods(handler FuncGeneratorDescription) []string {
+	if len(handler.Methods) == 0 {
+		return []string{"get", "post"}
+	}
+	res := make([]string, 0, len(handler.Methods))
+	for _, method := range handler.Methods {
+		res = append(res, strings.ToLower(method))
+	}
+	return res
+}
+
+func (b *openapiBuilder) operation(handler FuncGeneratorDescription, method string, operationID string) (yamlMap, error) {
+	op := yamlMap{}.
+		with("operationId", operationID).
+		with("tags", []string{handler.ReceiverTypeName})
+
+	params, err := b.paramProperties(handler.InputBusinessParamName)
+	if err != nil {
+		return nil, err
+	}
+	properties, required := params.properties, params.required
+
+	pathParams := []interface{}{}
+	for _, param := range urlTemplateParams(handler.Url) {
+		schema, ok := params.pathFields.lookup(param.name)
+		if !ok {
+			schema, _ = basicTypeSchema(param.paramType)
+		}
+		pathParams = append(pathParams, yamlMap{}.
+			with("name", param.name).
+			with("in", "path").
+			with("required", true).
+			with("schema", schema))
+	}
+
+	switch method {
+	case "get", "head", "delete":
+		queryParams := pathParams
+		for _, prop := range properties {
+			param := yamlMap{}.
+				with("name", prop.Key).
+				with("in", "query")
+			if required[prop.Key] {
+				param = param.with("required", true)
+			}
+			if params.commaSeparated[prop.Key] {
+				param = param.with("style", "form").with("explode", false)
+			}
+			queryParams = append(queryParams, param.with("schema", prop.Value))
+		}
+		if len(queryParams) > 0 {
+			op = op.with("parameters", queryParams)
+		}
+	default:
+		if len(pathParams) > 0 {
+			op = op.with("parameters", pathParams)
+		}
+		if len(properties) == 0 {
+			break
+		}
+		bodySchema := yamlMap{}.
+			with("type", "object").
+			with("properties", properties)
+		requiredNames := []string{}
+		for _, prop := range properties {
+			if required[prop.Key] {
+				requiredNames = append(requiredNames, prop.Key)
+			}
+		}
+		if len(requiredNames) > 0 {
+			bodySchema = bodySchema.with("required", requiredNames)
+		}
+
+		// JSON body carries the same fields under names from json tags
+		jsonProperties := yamlMap{}
+		for _, prop := range properties {
+			jsonProperties = jsonProperties.with(params.jsonNames[prop.Key], prop.Value)
+		}
+		jsonRequired := []string{}
+		for _, name := range requiredNames {
+			jsonRequired = append(jsonRequired, params.jsonNames[name])
+		}
+		jsonSchema := yamlMap{}.
+			with("type", "object").
+			with("properties", jsonProperties)
+		if len(jsonRequired) > 0 {
+			jsonSchema = jsonSchema.with("required", jsonRequired)
+		}
+
+		op = op.with("requestBody", yamlMap{}.
+			with("required", len(requiredNames) > 0).
+			with("content", yamlMap{}.
+				with("application/x-www-form-urlencoded", yamlMap{}.
+					with("schema", bodySchema)).
+				with("application/json", yamlMap{}.
+					with("schema", jsonSchema))))
+	}
+
+	responses := yamlMap{}.with("200", yamlMap{}.
+		with("description", "successful response").
+		with("content", jsonContent(b.envelopeSchema(handler.resultType))))
+	responses = responses.with("400", errorResponse("invalid parameters"))
+	if handler.Auth {
+		responses = responses.
+			with("401", errorResponse("authentication failed")).
+			with("403", errorResponse("access denied"))
+	}
+	if handler.rateLimit != nil {
+		responses = responses.with("429", errorResponse("rate limit exceeded, retry after Retry-After seconds"))
+	}
+	responses = responses.with("500", errorResponse("internal error"))
+	if handler.timeout > 0 {
+		responses = responses.with("504", errorResponse("timeout of "+handler.timeout.String()+" exceeded"))
+	}
+	responses = responses.with("default", errorResponse("error returned by the handler"))
+	op = op.with("responses", responses)
+
+	if handler.Auth {
+		op = op.with("security", []interface{}{yamlMap{}.with(authSecurityScheme, []string{})})
+	}
+	if len(handler.Roles) > 0 {
+		op = op.with("x-roles", handler.Roles)
+	}
+	if len(handler.Scopes) > 0 {
+		op = op.with("x-scopes", handler.Scopes)
+	}
+	if handler.timeout > 0 {
+		op = op.with("x-timeout", handler.timeout.String())
+	}
+	if handler.rateLimit != nil {
+		op = op.with("x-ratelimit", handler.RateLimit)
+	}
+	return op, nil
+}
+
+// paramsDoc describes fields of the parameters struct as they are read by ValidateParams
+type paramsDoc struct {
+	// properties are keyed by form names
+	properties yamlMap
+	required   map[string]bool
+	// jsonNames maps form names to the names used in JSON body
+	jsonNames map[string]string
+	// pathFields are bound to path parameters, keyed by parameter name
+	pathFields yamlMap
+	// commaSeparated lists slices which items may be joined with comma
+	commaSeparated map[string]bool
+}
+
+// sliceSchema wraps item schema into array one
+func sliceSchema(items yamlMap, scalar scalarType, valParams ValidateAttr) (yamlMap, error) {
+	schema := yamlMap{}.with("type", "array").with("items", items)
+	if valParams.MinItems > 0 {
+		schema = schema.with("minItems", valParams.MinItems)
+	}
+	if valParams.HasMaxItems {
+		schema = schema.with("maxItems", valParams.MaxItems)
+	}
+	if valParams.Unique {
+		schema = schema.with("uniqueItems", true)
+	}
+	if valParams.DefaultValue != "" {
+		defaultVal := []interface{}{}
+		for _, val := range strings.Split(valParams.DefaultValue, "|") {
+			typedVal, err := typedValue(scalar, val)
+			if err != nil {
+				return nil, fmt.Errorf("bad default value %q", val)
+			}
+			defaultVal = append(defaultVal, typedVal)
+		}
+		schema = schema.with("default", defaultVal)
+	}
+	return schema, nil
+}
+
+func (b *openapiBuilder) paramProperties(typeName string) (*paramsDoc, error) {
+	doc := &paramsDoc{
+		required:       make(map[string]bool),
+		jsonNames:      make(map[string]string),
+		commaSeparated: make(map[string]bool),
+	}
+	var err error
+	for _, filed := range b.m.params[typeName].Fields {
+		valParams := filed.Attr
+		fieldName := strings.ToLower(filed.Name)
+		if valParams.ParamName != "" {
+			fieldName = valParams.ParamName
+		}
+
+		filedType, isSlice := filed.Scalar, filed.IsSlice
+		scalar := scalarTypes[filedType]
+		schema, _ := basicTypeSchema(filedType)
+		if len(valParams.EnumValues) > 0 {
+			enum := []interface{}{}
+			for _, val := range valParams.EnumValues {
+				typedVal, err := typedValue(scalar, val)
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: bad enum value %q", typeName, filed.Name, val)
+				}
+				enum = append(enum, typedVal)
+			}
+			schema = schema.with("enum", enum)
+		}
+		if valParams.DefaultValue != "" && !isSlice {
+			defaultVal, err := typedValue(scalar, valParams.DefaultValue)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: bad default value %q", typeName, filed.Name, valParams.DefaultValue)
+			}
+			schema = schema.with("default", defaultVal)
+		}
+		minKey, maxKey := "minimum", "maximum"
+		if scalar.kind == "string" {
+			minKey, maxKey = "minLength", "maxLength"
+		}
+		if valParams.HasMin {
+			schema = schema.set(minKey, numberValue(valParams.Min))
+		}
+		if valParams.HasMax {
+			schema = schema.set(maxKey, numberValue(valParams.Max))
+		}
+		if isSlice {
+			schema, err = sliceSchema(schema, scalar, valParams)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", typeName, filed.Name, err)
+			}
+			if valParams.CommaSeparated {
+				doc.commaSeparated[fieldName] = true
+			}
+		}
+
+		if valParams.PathName != "" {
+			doc.pathFields = doc.pathFields.with(valParams.PathName, schema)
+			continue
+		}
+		doc.properties = doc.properties.with(fieldName, schema)
+		doc.jsonNames[fieldName] = fieldName
+		if valParams.JSONName != "" {
+			doc.jsonNames[fieldName] = valParams.JSONName
+		}
+		if valParams.IsRequired {
+			doc.required[fieldName] = true
+		}
+	}
+	return doc, nil
+}
+
+// typedValue converts tag value to the JSON type of the field
+func typedValue(scalar scalarType, val string) (interface{}, error) {
+	switch scalar.kind {
+	case "bool":
+		return strconv.ParseBool(val)
+	case "int", "uint", "float":
+		number, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, err
+		}
+		return numberValue(number), nil
+	}
+	return val, nil
+}
+
+// numberValue keeps whole numbers integer in the document
+func numberValue(val float64) interface{} {
+	if val == float64(int(val)) {
+		return int(val)
+	}
+	return val
+}
+
+// envelopeSchema describes DefaultResponseWrapper carrying the result type
+func (b *openapiBuilder) envelopeSchema(resultType types.Type) yamlMap {
+	response := yamlMap{}
+	if resultType != nil {
+		response = b.typeSchema(resultType)
+	}
+	return yamlMap{}.with("allOf", []interface{}{
+		yamlMap{}.with("$ref", schemaRefPrefix+envelopeSchemaName),
+		yamlMap{}.
+			with("required", []string{b.m.Config.Envelope.Response}).
+			with("properties", yamlMap{}.
+				with(b.m.Config.Envelope.Error, yamlMap{}.with("const", "")).
+				with(b.m.Config.Envelope.Response, response)),
+	})
+}
+
+func errorResponse(description string) yamlMap {
+	return yamlMap{}.
+		with("description", description).
+		with("content", jsonContent(yamlMap{}.with("$ref", schemaRefPrefix+envelopeSchemaName)))
+}
+
+func jsonContent(schema yamlMap) yamlMap {
+	return yamlMap{}.with("application/json", yamlMap{}.with("schema", schema))
+}
+
+// typeSchema returns JSON schema of the go type the way encoding/json marshals it,
+// named types are added to components and referenced
+func (b *openapiBuilder) typeSchema(t types.Type) yamlMap {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		return b.typeSchema(t.Elem())
+	case *types.Slice:
+		if basic, ok := t.Elem().(*types.Basic); ok && basic.Kind() == types.Byte {
+			return yamlMap{}.with("type", "string").with("contentEncoding", "base64")
+		}
+		return yamlMap{}.with("type", "array").with("items", b.typeSchema(t.Elem()))
+	case *types.Array:
+		return yamlMap{}.with("type", "array").with("items", b.typeSchema(t.Elem()))
+	case *types.Map:
+		return yamlMap{}.with("type", "object").with("additionalProperties", b.typeSchema(t.Elem()))
+	case *types.Struct:
+		return b.structSchema(t)
+	case *types.Basic:
+		if schema, ok := basicTypeSchema(t.Name()); ok {
+			return schema
+		}
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() == nil {
+			if schema, ok := basicTypeSchema(obj.Name()); ok {
+				return schema
+			}
+			return yamlMap{}
+		}
+		if obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return yamlMap{}.with("type", "string").with("format", "date-time")
+		}
+		if _, ok := t.Underlying().(*types.Interface); ok {
+			return yamlMap{}
+		}
+		key := types.TypeString(t, nil)
+		name, ok := b.components[key]
+		if !ok {
+			name = b.componentName(obj)
+			b.components[key] = name
+			idx := len(b.schemas)
+			b.schemas = b.schemas.with(name, nil)
+			schema := b.typeSchema(t.Underlying())
+			b.schemas[idx].Value = schema
+		}
+		return yamlMap{}.with("$ref", schemaRefPrefix+name)
+	}
+	return yamlMap{}
+}
+
+// componentName is the name of the type, when another type has it already
+// the name is qualified with the package and then numbered
+func (b *openapiBuilder) componentName(obj *types.TypeName) string {
+	name := obj.Name()
+	if b.taken[name] {
+		name = obj.Pkg().Name() + "." + obj.Name()
+	}
+	for i := 2; b.taken[name]; i++ {
+		name = fmt.Sprintf("%s.%s%d", obj.Pkg().Name(), obj.Name(), i)
+	}
+	b.taken[name] = true
+	return name
+}
+
+func (b *openapiBuilder) structSchema(currStruct *types.Struct) yamlMap {
+	properties := yamlMap{}
+	required := []string{}
+	for i := 0; i < currStruct.NumFields(); i++ {
+		filed := currStruct.Field(i)
+		jsonName, omitEmpty, skip := "", false, false
+		if jsonTag, ok := reflect.StructTag(currStruct.Tag(i)).Lookup("json"); ok {
+			parts := strings.Split(jsonTag, ",")
+			jsonName, skip = parts[0], parts[0] == "-" && len(parts) == 1
+			for _, opt := range parts[1:] {
+				omitEmpty = omitEmpty || opt == "omitempty"
+			}
+		}
+		if skip {
+			continue
+		}
+
+		if filed.Embedded() && jsonName == "" {
+			// embedded struct without name in tag is flattened by encoding/json
+			if embeddedStruct, ok := namedOrPointerUnderlying(filed.Type()).(*types.Struct); ok {
+				schema := b.structSchema(embeddedStruct)
+				if props, ok := schema.lookup("properties"); ok {
+					properties = append(properties, props.(yamlMap)...)
+				}
+				if req, ok := schema.lookup("required"); ok {
+					required = append(required, req.([]string)...)
+				}
+			}
+			continue
+		}
+		if !filed.Exported() {
+			continue
+		}
+		propName := jsonName
+		if propName == "" {
+			propName = filed.Name()
+		}
+		properties = properties.with(propName, b.typeSchema(filed.Type()))
+		if !omitEmpty {
+			required = append(required, propName)
+		}
+	}
+
+	schema := yamlMap{}.with("type", "object").with("properties", properties)
+	if len(required) > 0 {
+		schema = schema.with("required", required)
+	}
+	return schema
+}
+
+// namedOrPointerUnderlying returns underlying type of the type or of the type the pointer points to
+func namedOrPointerUnderlying(t types.Type) types.Type {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	return t.Underlying()
+}
+
+func basicTypeSchema(name string) (yamlMap, bool) {
+	switch name {
+	case "string":
+		return yamlMap{}.with("type", "string"), true
+	case "bool":
+		return yamlMap{}.with("type", "boolean"), true
+	case "int", "int8", "int16", "rune":
+		return yamlMap{}.with("type", "integer"), true
+	case "int32":
+		return yamlMap{}.with("type", "integer").with("format", "int32"), true
+	case "int64":
+		return yamlMap{}.with("type", "integer").with("format", "int64"), true
+	case "uint", "uint8", "uint16", "uint32", "uint64", "byte", "uintptr":
+		return yamlMap{}.with("type", "integer").with("minimum", 0), true
+	case "float32":
+		return yamlMap{}.with("type", "number").with("format", "float"), true
+	case "float64":
+		return yamlMap{}.with("type", "number").with("format", "double"), true
+	case "error":
+		return yamlMap{}.with("type", "string"), true
+	}
+	return nil, false
+}
@@ -0,0 +1,78 @@
+package apigen
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files of testdata")
+
+func TestOpenAPIGolden(t *testing.T) {
+	m, err := Load(filepath.Join("testdata", "users"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := Generate(m, buf, Options{Output: OpenAPI}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "users", "openapi.golden.yaml")
+	if *update {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v, go test -update writes it", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("OpenAPI document differs from %s, go test -update rewrites it\nGot:\n%s", golden, buf.Bytes())
+	}
+}
+
+func TestOpenAPIComponentNames(t *testing.T) {
+	// User другого пакета не подменяет схему User этого пакета
+	t.Setenv("GOPROXY", "off")
+	dir := writePackage(t, map[string]string{
+		"go.mod": "module example.com/fixture\n\ngo 1.22\n",
+		"api.go": "package fixture\n\nimport (\n\t\"context\"\n\n\t\"example.com/fixture/other\"\n)\n\n" +
+			"type S struct{}\n\ntype P struct {\n\tName string\n}\n\ntype User struct {\n\tLogin string `json:\"login\"`\n}\n\n" +
+			"// apigen:api {\"url\": \"/a\"}\nfunc (s *S) A(ctx context.Context, in P) (*User, error) { return nil, nil }\n\n" +
+			"// apigen:api {\"url\": \"/b\"}\nfunc (s *S) B(ctx context.Context, in P) (*other.User, error) { return nil, nil }\n",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other", "other.go"), []byte("package other\n\ntype User struct {\n\tEmail string `json:\"email\"`\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	doc, err := m.buildOpenAPI()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	components, _ := doc.lookup("components")
+	schemas, _ := components.(yamlMap).lookup("schemas")
+	got := map[string]string{}
+	for _, item := range schemas.(yamlMap) {
+		props, _ := item.Value.(yamlMap).lookup("properties")
+		if len(props.(yamlMap)) > 0 {
+			got[item.Key] = props.(yamlMap)[0].Key
+		}
+	}
+	expected := map[string]string{"User": "login", "other.User": "email", envelopeSchemaName: "error"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected components\nGot: %#v\nExpected: %#v", got, expected)
+	}
+}
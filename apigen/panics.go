@@ -0,0 +1,76 @@
+package apigen
+
+// panicHelpers answer panics of endpoints with the envelope instead of dropping the connection
+const panicHelpers = `// PanicHandler may be implemented by receivers to observe panics of endpoints,
+// the response is 500 with "internal error" either way
+type PanicHandler interface {
+	OnPanic(ctx context.Context, endpoint string, v interface{}, stack []byte)
+}
+
+// apigenRecover must be deferred by the wrapper, http.ErrAbortHandler is passed on to net/http
+func apigenRecover(w http.ResponseWriter, r *http.Request, srv interface{}, endpoint string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	stack := debug.Stack()
+	if p, ok := v.(apigenPanic); ok {
+		v, stack = p.v, p.stack
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	if h, ok := srv.(PanicHandler); ok {
+		h.OnPanic(r.Context(), endpoint, v, stack)
+	}
+	apigenWriteError(w, http.StatusInternalServerError, errors.New("internal error"))
+}
+
+// apigenPanic carries the panic of the method called by apigenCallTimeout to apigenRecover
+type apigenPanic struct {
+	v     interface{}
+	stack []byte
+}
+
+type apigenResult struct {
+	res interface{}
+	err error
+	// p is set when the method panics
+	p *apigenPanic
+}
+
+// apigenCallTimeout runs the method aside so that the deadline is answered even when the method
+// ignores ctx, the result, the error and panics of the method after the deadline are dropped
+func apigenCallTimeout(ctx context.Context, call func() (interface{}, error)) (interface{}, error) {
+	done := make(chan apigenResult, 1)
+	go func() {
+		var out apigenResult
+		defer func() {
+			if v := recover(); v != nil {
+				out.p = &apigenPanic{v, debug.Stack()}
+			}
+			done <- out
+		}()
+		out.res, out.err = call()
+	}()
+	var out apigenResult
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		select {
+		case out = <-done:
+		default:
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ctx.Err()
+			}
+			// the request is canceled, nobody waits for the response
+			out = <-done
+		}
+	}
+	if out.p != nil {
+		panic(*out.p)
+	}
+	return out.res, out.err
+}
+
+`
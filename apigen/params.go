@@ -0,0 +1,187 @@
+package apigen
+
+// paramsSourceHelpers hides where parameters come from:
+// url query and form body, or JSON body for application/json requests
+const paramsSourceHelpers = `// apigenMaxBodyBytes limits JSON bodies the same way net/http limits form bodies
+const apigenMaxBodyBytes = 10 << 20
+
+type apigenParams struct {
+	r    *http.Request
+	body map[string]json.RawMessage
+}
+
+func apigenReadParams(r *http.Request) (*apigenParams, error) {
+	params := &apigenParams{r: r}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return params, nil
+	}
+	params.body = make(map[string]json.RawMessage)
+	err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, apigenMaxBodyBytes)).Decode(&params.body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, ApiError{http.StatusRequestEntityTooLarge, fmt.Errorf("JSON body exceeds %d bytes", tooLarge.Limit)}
+	}
+	if err != nil && err != io.EOF {
+		return nil, ApiError{http.StatusBadRequest, fmt.Errorf("malformed JSON body: %v", err)}
+	}
+	return params, nil
+}
+
+// value returns parameter as it would be sent in the form, JSON values must match the field type
+func (p *apigenParams) value(formName string, jsonName string, fieldType string) (string, error) {
+	if p.body == nil {
+		return p.r.FormValue(formName), nil
+	}
+	raw, ok := p.body[jsonName]
+	if !ok || string(raw) == "null" {
+		return "", nil
+	}
+	return apigenJSONValue(jsonName, raw, fieldType)
+}
+
+func apigenJSONValue(jsonName string, raw json.RawMessage, fieldType string) (string, error) {
+	if fieldType == "string" {
+		var val string
+		if err := json.Unmarshal(raw, &val); err != nil {
+			return "", ApiError{http.StatusBadRequest, fmt.Errorf("%s must be string", jsonName)}
+		}
+		return val, nil
+	}
+	if fieldType == "bool" {
+		if string(raw) != "true" && string(raw) != "false" {
+			return "", ApiError{http.StatusBadRequest, fmt.Errorf("%s must be bool", jsonName)}
+		}
+		return string(raw), nil
+	}
+	// numbers are passed as is and parsed the same way as form values
+	var val json.Number
+	if c := raw[0]; (c < '0' || c > '9') && c != '-' || json.Unmarshal(raw, &val) != nil {
+		return "", ApiError{http.StatusBadRequest, fmt.Errorf("%s must be %s", jsonName, fieldType)}
+	}
+	return val.String(), nil
+}
+
+func apigenInEnum(value string, enum ...string) bool {
+	for _, val := range enum {
+		if value == val {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError lists every invalid parameter, it is returned
+// by endpoints collecting all validation errors
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (ve ValidationError) Error() string {
+	return "validation failed"
+}
+
+type apigenFieldErrors struct {
+	collect bool
+	fields  map[string]string
+}
+
+// add returns err back unless errors are collected
+func (fe *apigenFieldErrors) add(name string, err error) error {
+	var e ApiError
+	if !fe.collect || !errors.As(err, &e) || e.HTTPStatus != http.StatusBadRequest {
+		return err
+	}
+	if fe.fields == nil {
+		fe.fields = make(map[string]string)
+	}
+	// messages start with the name of parameter which is the key already
+	msg := e.Err.Error()
+	if len(msg) > len(name) && msg[:len(name)+1] == name+" " {
+		msg = msg[len(name)+1:]
+	}
+	fe.fields[name] = msg
+	return nil
+}
+
+func (fe *apigenFieldErrors) err() error {
+	if len(fe.fields) == 0 {
+		return nil
+	}
+	return ApiError{http.StatusBadRequest, ValidationError{fe.fields}}
+}
+
+// apigenParseError reports numbers which cannot be parsed or do not fit into the field
+func apigenParseError(name string, fieldType string, err error) error {
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return ApiError{http.StatusBadRequest, fmt.Errorf("%s is out of %s range", name, fieldType)}
+	}
+	return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be %s", name, fieldType)}
+}
+
+`
+
+// sliceParamsHelpers read repeated keys of the form and JSON arrays
+const sliceParamsHelpers = `// values returns all non empty values of repeated form key, or items of JSON array
+func (p *apigenParams) values(formName string, jsonName string, fieldType string, commaSeparated bool) ([]string, error) {
+	res := []string{}
+	if p.body == nil {
+		if p.r.Form == nil {
+			p.r.ParseMultipartForm(32 << 20)
+		}
+		for _, val := range p.r.Form[formName] {
+			parts := []string{val}
+			if commaSeparated {
+				parts = strings.Split(val, ",")
+			}
+			for _, part := range parts {
+				if part != "" {
+					res = append(res, part)
+				}
+			}
+		}
+		return res, nil
+	}
+	raw, ok := p.body[jsonName]
+	if !ok || string(raw) == "null" {
+		return res, nil
+	}
+	items := []json.RawMessage{}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, ApiError{http.StatusBadRequest, fmt.Errorf("%s must be array", jsonName)}
+	}
+	for _, item := range items {
+		val, err := apigenJSONValue(jsonName, item, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// apigenDuplicate returns the first repeated value
+func apigenDuplicate(values []string) (string, bool) {
+	seen := make(map[string]bool, len(values))
+	for _, val := range values {
+		if seen[val] {
+			return val, true
+		}
+		seen[val] = true
+	}
+	return "", false
+}
+
+`
+
+// hasSliceParams reports whether any parameters struct has slice fields
+func (m *Model) hasSliceParams() bool {
+	for _, ps := range m.Params {
+		for _, filed := range ps.Fields {
+			if filed.IsSlice {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package apigen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimit is parsed ratelimit of the annotation, "10/s burst=20 key=auth"
+type rateLimit struct {
+	Count int
+	Per   time.Duration
+	Burst int
+	// Key is auth, ip or header, Header is the header of the caller identity for auth and header keys
+	Key    string
+	Header string
+}
+
+// rateLimitData is passed to the rateLimit template
+type rateLimitData struct {
+	// Endpoint names buckets of the endpoint
+	Endpoint string
+	// Limit and Caller are go expressions of RateLimit and of the caller identity
+	Limit  string
+	Caller string
+	// AfterAuth checks the limit after the caller is authenticated
+	AfterAuth bool
+}
+
+// parseRateLimit reads "<count>/<period> [burst=<n>] [key=auth|ip|header:<name>]", period is a unit
+// of time.ParseDuration with optional number, burst defaults to count and key to ip
+func parseRateLimit(text string, authHeader string) (*rateLimit, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("ratelimit is empty")
+	}
+	rate := strings.SplitN(fields[0], "/", 2)
+	if len(rate) != 2 {
+		return nil, fmt.Errorf("ratelimit %q must start with <count>/<period> like 10/s", text)
+	}
+	count, err := strconv.Atoi(rate[0])
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("ratelimit %q: count must be a positive integer", text)
+	}
+	period := rate[1]
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return nil, fmt.Errorf("ratelimit %q: period must be a positive duration like s, m or 10s", text)
+	}
+	res := &rateLimit{Count: count, Per: per, Burst: count, Key: "ip"}
+	for _, field := range fields[1:] {
+		switch {
+		case strings.HasPrefix(field, "burst="):
+			burst, err := strconv.Atoi(strings.TrimPrefix(field, "burst="))
+			if err != nil || burst <= 0 {
+				return nil, fmt.Errorf("ratelimit %q: burst must be a positive integer", text)
+			}
+			res.Burst = burst
+		case field == "key=auth":
+			res.Key, res.Header = "auth", authHeader
+		case field == "key=ip":
+			res.Key, res.Header = "ip", ""
+		case strings.HasPrefix(field, "key=header:") && field != "key=header:":
+			res.Key, res.Header = "header", strings.TrimPrefix(field, "key=header:")
+		default:
+			return nil, fmt.Errorf("ratelimit %q: unknown option %q, expected burst=<n> or key=auth|ip|header:<name>", text, field)
+		}
+	}
+	return res, nil
+}
+
+// data returns the rateLimit template data of the endpoint
+func (rl *rateLimit) data(val FuncGeneratorDescription) *rateLimitData {
+	caller := "apigenRemoteIP(r)"
+	switch rl.Key {
+	case "auth":
+		caller = "apigenAuthKey(srv, r, " + strconv.Quote(rl.Header) + ")"
+	case "header":
+		caller = "r.Header.Get(" + strconv.Quote(rl.Header) + ")"
+	}
+	return &rateLimitData{
+		Endpoint:  val.ReceiverTypeName + "." + val.FuncName,
+		Limit:     fmt.Sprintf("RateLimit{Count: %d, Per: %s, Burst: %d}", rl.Count, durationExpr(rl.Per), rl.Burst),
+		Caller:    caller,
+		AfterAuth: rl.Key == "auth",
+	}
+}
+
+func (m *Model) hasRateLimits() bool {
+	for _, recv := range m.Receivers {
+		if recv.hasRateLimits() {
+			return true
+		}
+	}
+	return false
+}
+
+func (recv *Receiver) hasRateLimits() bool {
+	for _, val := range recv.Endpoints {
+		if val.rateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitHelpers check limits with the in-process token bucket of the handler unless options
+// or the receiver provide Limiter
+const rateLimitHelpers = `// RateLimit is the token bucket of the endpoint, Count tokens are added every Per up to Burst
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+	Burst int
+}
+
+// Limiter takes a token from the bucket of the key, retryAfter tells when the next one is available,
+// WithLimiter or receivers implementing Limiter replace the in-process limiter of the handler,
+// for example with a shared store
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitKeyer may be implemented by receivers to name the caller of key=auth limits
+// from the context returned by Authenticate, the hash of the token is used otherwise
+type RateLimitKeyer interface {
+	RateLimitKey(ctx context.Context) string
+}
+
+// WithLimiter replaces limiters of handlers, they are shared by every handler built with the option
+func WithLimiter(l Limiter) Option {
+	return func(o *apigenOptions) {
+		o.limiter = l
+	}
+}
+
+type apigenBucket struct {
+	tokens float64
+	at     time.Time
+	// full is the time the bucket is refilled, full buckets are dropped
+	full time.Time
+}
+
+// apigenMemoryLimiter keeps buckets in memory of the process
+type apigenMemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*apigenBucket
+	swept   time.Time
+}
+
+// apigenNewLimiter returns the limiter of options, the receiver implementing Limiter
+// or a new in-process limiter
+func apigenNewLimiter(srv interface{}, o *apigenOptions) Limiter {
+	if o.limiter != nil {
+		return o.limiter
+	}
+	if l, ok := srv.(Limiter); ok {
+		return l
+	}
+	return &apigenMemoryLimiter{buckets: make(map[string]*apigenBucket)}
+}
+
+// apigenStatelessLimiter is the limiter of ServeHTTP of receivers, it has nowhere to keep buckets
+// between requests, so every request is allowed unless the receiver implements Limiter
+func apigenStatelessLimiter(srv interface{}) Limiter {
+	if l, ok := srv.(Limiter); ok {
+		return l
+	}
+	return apigenNoLimiter{}
+}
+
+type apigenNoLimiter struct{}
+
+func (apigenNoLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	return true, 0, nil
+}
+
+func (l *apigenMemoryLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	perToken := float64(limit.Per) / float64(limit.Count)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &apigenBucket{tokens: float64(limit.Burst), at: now}
+		l.buckets[key] = b
+	}
+	b.tokens += float64(now.Sub(b.at)) / perToken
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * perToken), nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) * perToken))
+	return true, 0, nil
+}
+
+// apigenRemoteIP returns the address of the peer, key=header:X-Real-IP is used behind proxies
+func apigenRemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// apigenAuthKey names the authenticated caller, the token itself is never used as the key
+func apigenAuthKey(srv interface{}, r *http.Request, header string) string {
+	if k, ok := srv.(RateLimitKeyer); ok {
+		return k.RateLimitKey(r.Context())
+	}
+	sum := sha256.Sum256([]byte(r.Header.Get(header)))
+	return hex.EncodeToString(sum[:])
+}
+
+// apigenAllow takes a token from the bucket of the caller of the endpoint, 429 is written when there is none
+func apigenAllow(w http.ResponseWriter, r *http.Request, limiter Limiter, endpoint string, limit RateLimit, caller string) bool {
+	ok, retryAfter, err := limiter.Allow(r.Context(), endpoint+" "+caller, limit)
+	if err != nil {
+		apigenWriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		apigenWriteError(w, http.StatusTooManyRequests, errors.New("too many requests"))
+		return false
+	}
+	return true
+}
+
+`
@@ -0,0 +1,166 @@
+package apigen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// muxData is passed to the mux template
+type muxData struct {
+	Receivers []muxReceiver
+	// Templated is set when some receiver has url templates
+	Templated bool
+}
+
+// muxReceiver is a receiver with full paths of its urls, prefix included
+type muxReceiver struct {
+	Name string
+	// Var names the argument of NewRouter and the field of Router
+	Var       string
+	Prefix    string
+	Paths     []string
+	Templates []string
+}
+
+// checkPrefix verifies that the prefix is a static path without trailing slash
+func checkPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, "{}?#") {
+		return fmt.Errorf("prefix %q must start with / and must not end with / or contain {, }, ? and #", prefix)
+	}
+	return nil
+}
+
+// checkEndpointPrefix verifies that the prefix of the endpoint agrees with prefixes already set for the receiver
+func (m *Model) checkEndpointPrefix(recvName string, prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if err := checkPrefix(prefix); err != nil {
+		return err
+	}
+	current := m.annotations[recvName].Prefix
+	if recv := m.Receiver(recvName); recv != nil && recv.Prefix != "" {
+		current = recv.Prefix
+	}
+	if current != "" && current != prefix {
+		return fmt.Errorf("prefix %s differs from prefix %s of %s", prefix, current, recvName)
+	}
+	return nil
+}
+
+// checkRouter reports urls served by more than one receiver once prefixes are added,
+// templates match the same paths when they differ only in names and types of parameters,
+// and a static url or another template may match paths of a template of a different receiver
+func (m *Model) checkRouter() error {
+	d := &diagnostics{fset: m.fset}
+	type route struct {
+		url string
+		val FuncGeneratorDescription
+	}
+	var routes []route
+	for _, recv := range m.Receivers {
+		seen := make(map[string]bool)
+		for _, val := range recv.Endpoints {
+			url := recv.Prefix + val.Url
+			key := routeKey(url)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			reported := false
+			for _, owner := range routes {
+				if owner.val.ReceiverTypeName == recv.Name || !routesOverlap(owner.url, url) {
+					continue
+				}
+				if routeKey(owner.url) == key {
+					d.errorf(val.pos, "apigen:api: %s is served by both %s.%s and %s.%s, set prefix of the receivers",
+						url, owner.val.ReceiverTypeName, owner.val.FuncName, recv.Name, val.FuncName)
+				} else {
+					d.errorf(val.pos, "apigen:api: %s of %s.%s and %s of %s.%s match the same paths, set prefix of the receivers",
+						owner.url, owner.val.ReceiverTypeName, owner.val.FuncName, url, recv.Name, val.FuncName)
+				}
+				reported = true
+				break
+			}
+			if !reported {
+				routes = append(routes, route{url, val})
+			}
+		}
+	}
+	return d.err()
+}
+
+// routesOverlap tells whether some path is matched by both urls, a parameter matches any
+// non-empty segment, {name:int} only integers
+func routesOverlap(a string, b string) bool {
+	aParts, bParts := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(aParts) != len(bParts) {
+		return false
+	}
+	for i := range aParts {
+		if !segmentsOverlap(aParts[i], bParts[i]) && !segmentsOverlap(bParts[i], aParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentsOverlap tells whether the segment is matched by the pattern segment
+func segmentsOverlap(pattern string, segment string) bool {
+	if !strings.HasPrefix(pattern, "{") {
+		return pattern == segment
+	}
+	if strings.HasPrefix(segment, "{") {
+		return true
+	}
+	if strings.HasSuffix(pattern, ":int}") {
+		_, err := strconv.Atoi(segment)
+		return err == nil
+	}
+	return segment != ""
+}
+
+// routeKey replaces parameters of the url template with {}
+func routeKey(url string) string {
+	segments := strings.Split(url, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") {
+			segments[i] = "{}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// mux collects full paths of every receiver for the mux template
+func (m *Model) mux() muxData {
+	res := muxData{}
+	for _, recv := range m.Receivers {
+		mr := muxReceiver{Name: recv.Name, Var: varName(recv.Name), Prefix: recv.Prefix}
+		for _, p := range recv.paths() {
+			if p.Templated {
+				mr.Templates = append(mr.Templates, recv.Prefix+p.Url)
+				res.Templated = true
+				continue
+			}
+			mr.Paths = append(mr.Paths, recv.Prefix+p.Url)
+		}
+		res.Receivers = append(res.Receivers, mr)
+	}
+	return res
+}
+
+// varName lowers the leading initialism or letter of the type name, MyApi becomes myApi and HTTPApi httpApi
+func varName(name string) string {
+	upper := 0
+	for upper < len(name) && name[upper] >= 'A' && name[upper] <= 'Z' {
+		upper++
+	}
+	if upper > 1 && upper < len(name) {
+		upper--
+	}
+	return strings.ToLower(name[:upper]) + name[upper:]
+}
@@ -0,0 +1,307 @@
+package apigen
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// pathParam is a {name} or {name:type} segment of the url template
+type pathParam struct {
+	name      string
+	paramType string
+}
+
+// pathParamTypes lists types that can be used in typed segments, {id:int}
+var pathParamTypes = map[string]bool{
+	"string": true,
+	"int":    true,
+}
+
+func isURLTemplate(url string) bool {
+	return strings.Contains(url, "{")
+}
+
+func (m *Model) hasURLTemplates() bool {
+	for _, val := range m.endpoints() {
+		if isURLTemplate(val.Url) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlTemplateParams returns path parameters of the url in order of appearance
+func urlTemplateParams(url string) []pathParam {
+	params := []pathParam{}
+	for _, segment := range strings.Split(url, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		param := pathParam{name: segment[1 : len(segment)-1], paramType: "string"}
+		if idx := strings.Index(param.name, ":"); idx != -1 {
+			param.name, param.paramType = param.name[:idx], param.name[idx+1:]
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// checkURLTemplate verifies that every placeholder takes the whole segment and has a known type
+func checkURLTemplate(url string) error {
+	seen := make(map[string]bool)
+	for _, segment := range strings.Split(url, "/") {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") || strings.Count(segment, "{") != 1 {
+			return fmt.Errorf("url %s: path parameter must take the whole segment, got %q", url, segment)
+		}
+	}
+	for _, param := range urlTemplateParams(url) {
+		if param.name == "" {
+			return fmt.Errorf("url %s: path parameter without name", url)
+		}
+		if !pathParamTypes[param.paramType] {
+			return fmt.Errorf("url %s: unknown type %q of path parameter %s", url, param.paramType, param.name)
+		}
+		if seen[param.name] {
+			return fmt.Errorf("url %s: duplicate path parameter %s", url, param.name)
+		}
+		seen[param.name] = true
+	}
+	return nil
+}
+
+// checkMethods verifies that methods are uppercase tokens listed once
+func checkMethods(methods MethodList) error {
+	for i, method := range methods {
+		if method == "" || strings.TrimLeft(method, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return fmt.Errorf("bad method %q", method)
+		}
+		if methods[:i].Has(method) {
+			return fmt.Errorf("method %s is listed twice", method)
+		}
+	}
+	return nil
+}
+
+// checkRoutes reports endpoints of the receiver serving the same method of the same url,
+// endpoint without methods serves all of them, and templates of the same paths: the first
+// template matching the path answers the request, 405 included, whatever templates follow it
+func (m *Model) checkRoutes(d *diagnostics) {
+	for _, recv := range m.Receivers {
+		byURL := make(map[string][]FuncGeneratorDescription)
+		templates := []FuncGeneratorDescription{}
+		for _, val := range recv.Endpoints {
+			prevs, ok := byURL[val.Url]
+			byURL[val.Url] = append(prevs, val)
+			if ok {
+				for _, prev := range prevs {
+					if method, ok := sharedMethod(prev.Methods, val.Methods); ok {
+						d.errorf(val.pos, "apigen:api: %s is already served by %s.%s", strings.TrimSpace(method+" "+val.Url), recv.Name, prev.FuncName)
+						break
+					}
+				}
+				continue
+			}
+			if !isURLTemplate(val.Url) {
+				continue
+			}
+			for _, prev := range templates {
+				if routeKey(prev.Url) == routeKey(val.Url) {
+					d.errorf(val.pos, "apigen:api: %s and %s of %s.%s differ only in path parameters", val.Url, prev.Url, recv.Name, prev.FuncName)
+					break
+				}
+				if routeCovers(prev.Url, val.Url) {
+					d.errorf(val.pos, "apigen:api: %s is never matched, %s of %s.%s matches its paths first", val.Url, prev.Url, recv.Name, prev.FuncName)
+					break
+				}
+			}
+			templates = append(templates, val)
+		}
+	}
+}
+
+// routeCovers tells whether every path matched by the url is matched by the pattern
+func routeCovers(pattern string, url string) bool {
+	patternParts, urlParts := strings.Split(pattern, "/"), strings.Split(url, "/")
+	if len(patternParts) != len(urlParts) {
+		return false
+	}
+	for i, segment := range urlParts {
+		if strings.HasPrefix(patternParts[i], "{") && strings.HasSuffix(patternParts[i], ":int}") && strings.HasPrefix(segment, "{") {
+			// an integer parameter covers only integer ones
+			if !strings.HasSuffix(segment, ":int}") {
+				return false
+			}
+			continue
+		}
+		if !segmentsOverlap(patternParts[i], segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// sharedMethod returns a method accepted by both lists, empty when both accept any method
+func sharedMethod(a MethodList, b MethodList) (string, bool) {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return "", true
+	case len(a) == 0:
+		return b[0], true
+	case len(b) == 0:
+		return a[0], true
+	}
+	for _, method := range a {
+		if b.Has(method) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// paths groups endpoints of the receiver by url in the order urls first appear,
+// endpoints and fallbacks of urls are numbered in that order
+func (recv *Receiver) paths() []pathData {
+	res := []pathData{}
+	index := make(map[string]int)
+	for _, val := range recv.Endpoints {
+		i, ok := index[val.Url]
+		if !ok {
+			i = len(res)
+			index[val.Url] = i
+			res = append(res, pathData{Url: val.Url, Templated: isURLTemplate(val.Url)})
+		}
+		route := routeData{FuncGeneratorDescription: val, Methods: val.Methods, CORSVar: corsVar(val)}
+		if val.rateLimit != nil {
+			route.RateLimit = val.rateLimit.data(val)
+		}
+		res[i].Routes = append(res[i].Routes, route)
+	}
+	endpoints, fallbacks := 0, 0
+	for i := range res {
+		res[i].setMethods()
+		for j := range res[i].Routes {
+			res[i].Routes[j].Index = endpoints
+			endpoints++
+		}
+		res[i].Fallback = -1
+		if !res[i].Any || res[i].Preflight {
+			res[i].Fallback = fallbacks
+			fallbacks++
+		}
+	}
+	return res
+}
+
+// setMethods adds implied HEAD to GET routes and fills Allow, checkRoutes guarantees
+// that endpoint accepting any method is the only one of the url
+func (p *pathData) setMethods() {
+	for _, route := range p.Routes {
+		if route.CORSVar != "" {
+			p.Preflight = true
+		}
+	}
+	if len(p.Routes[0].Methods) == 0 {
+		p.Any = true
+		return
+	}
+	var allow MethodList
+	for _, route := range p.Routes {
+		allow = append(allow, route.Methods...)
+	}
+	if allow.Has(http.MethodGet) && !allow.Has(http.MethodHead) {
+		for i := range p.Routes {
+			if MethodList(p.Routes[i].Methods).Has(http.MethodGet) {
+				p.Routes[i].Methods = append(append([]string{}, p.Routes[i].Methods...), http.MethodHead)
+			}
+		}
+		allow = append(allow, http.MethodHead)
+	}
+	p.ExplicitOptions = allow.Has(http.MethodOptions)
+	if !p.ExplicitOptions {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+	p.Allow = strings.Join(allow, ", ")
+	p.Methods = allow
+	for i := range p.Routes {
+		p.Routes[i].AllowMethods = strings.Join(p.Routes[i].Methods, ", ")
+	}
+}
+
+// checkPathBinding verifies that every path parameter is bound to a field and every bound field is in the url
+func checkPathBinding(url string, ps *ParamsStruct) error {
+	bound := make(map[string]bool)
+	for _, filed := range ps.Fields {
+		if filed.Attr.PathName != "" {
+			bound[filed.Attr.PathName] = true
+		}
+	}
+	for _, param := range urlTemplateParams(url) {
+		if !bound[param.name] {
+			return fmt.Errorf("url %s: no field of %s is bound to path parameter %s", url, ps.TypeName, param.name)
+		}
+		delete(bound, param.name)
+	}
+	for _, filed := range ps.Fields {
+		if bound[filed.Attr.PathName] {
+			return fmt.Errorf("url %s has no path parameter %s bound to %s.%s", url, filed.Attr.PathName, ps.TypeName, filed.Name)
+		}
+	}
+	return nil
+}
+
+// openapiPath strips types from placeholders, /user/{id:int} becomes /user/{id}
+func openapiPath(url string) string {
+	for _, param := range urlTemplateParams(url) {
+		url = strings.Replace(url, "{"+param.name+":"+param.paramType+"}", "{"+param.name+"}", 1)
+	}
+	return url
+}
+
+// pathParamsHelpers match url templates and pass values of path parameters to validators
+const pathParamsHelpers = `type apigenPathParamsKey struct{}
+
+// apigenMatchPath matches escaped request path against url template with {name} and {name:int} segments
+func apigenMatchPath(template string, path string) (map[string]string, bool) {
+	templateParts := strings.Split(template, "/")
+	pathParts := strings.Split(path, "/")
+	if len(templateParts) != len(pathParts) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, part := range templateParts {
+		if !strings.HasPrefix(part, "{") {
+			if part != pathParts[i] {
+				return nil, false
+			}
+			continue
+		}
+		value, err := url.PathUnescape(pathParts[i])
+		if err != nil || value == "" {
+			return nil, false
+		}
+		name := part[1 : len(part)-1]
+		if idx := strings.Index(name, ":"); idx != -1 {
+			if name[idx+1:] == "int" {
+				if _, err := strconv.Atoi(value); err != nil {
+					return nil, false
+				}
+			}
+			name = name[:idx]
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+// apigenPathParam returns value of the path parameter matched by the router
+func apigenPathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(apigenPathParamsKey{}).(map[string]string)
+	return params[name]
+}
+`
@@ -0,0 +1,78 @@
+package apigen
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckRoutes(t *testing.T) {
+	dir := writePackage(t, map[string]string{"api.go": fixtureHeader + `
+type L struct {
+	Login string ` + "`apivalidator:\"path=login\"`" + `
+}
+
+type N struct {
+	Name string ` + "`apivalidator:\"path=name\"`" + `
+}
+
+type LI struct {
+	Login string ` + "`apivalidator:\"path=login\"`" + `
+	ID    int    ` + "`apivalidator:\"path=id\"`" + `
+}
+
+type LN struct {
+	Login string ` + "`apivalidator:\"path=login\"`" + `
+	Name  string ` + "`apivalidator:\"path=name\"`" + `
+}
+
+// apigen:api {"url": "/user/{login}", "method": "GET"}
+func (s *S) Get(ctx context.Context, in L) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}", "method": "POST"}
+func (s *S) Update(ctx context.Context, in L) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{name}", "method": "DELETE"}
+func (s *S) Delete(ctx context.Context, in N) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}/{id:int}"}
+func (s *S) Item(ctx context.Context, in LI) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}/list"}
+func (s *S) List(ctx context.Context, in L) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}/{name}"}
+func (s *S) Other(ctx context.Context, in LN) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}/items"}
+func (s *S) Items(ctx context.Context, in L) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/{login}/7"}
+func (s *S) Seven(ctx context.Context, in L) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/user/list"}
+func (s *S) Static(ctx context.Context, in P) (*R, error) { return nil, nil }
+`})
+
+	_, err := Load(dir)
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected ErrorList, got %#v", err)
+	}
+	got := []string{}
+	for _, e := range list {
+		rel, _ := filepath.Rel(dir, e.Pos.Filename)
+		e.Pos.Filename = rel
+		got = append(got, e.Error())
+	}
+	// статичные url и шаблоны, совпадающие с частью путей предыдущих, допустимы
+	expected := []string{
+		"api.go:46:1: apigen:api: /user/{name} and /user/{login} of S.Get differ only in path parameters",
+		"api.go:55:1: apigen:api: /user/{login}/{name} and /user/{login}/{id:int} of S.Item differ only in path parameters",
+		"api.go:58:1: apigen:api: /user/{login}/items is never matched, /user/{login}/{name} of S.Other matches its paths first",
+		"api.go:61:1: apigen:api: /user/{login}/7 is never matched, /user/{login}/{id:int} of S.Item matches its paths first",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected errors\nGot: %#v\nExpected: %#v", got, expected)
+	}
+}
@@ -0,0 +1,704 @@
+package apigen
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TemplateNames lists templates which may be replaced by files <name>.tmpl of the -templates directory,
+// a file defines the template with its name and may define any helper templates it uses
+var TemplateNames = []string{
+	"envelope", "authHelpers", "pathParamsHelpers", "paramsHelpers", "sliceParamsHelpers", "panicHelpers",
+	"rateLimitHelpers", "corsHelpers", "options", "router", "wrapper", "validator", "mux",
+	"clientErrors", "clientHelpers", "client",
+}
+
+// defaultTemplates are compiled into the generator
+var defaultTemplates = map[string]string{
+	"envelope":           envelopeTemplate,
+	"authHelpers":        authHelpersTemplate,
+	"pathParamsHelpers":  pathParamsHelpers,
+	"paramsHelpers":      paramsSourceHelpers,
+	"sliceParamsHelpers": sliceParamsHelpers,
+	"panicHelpers":       panicHelpers,
+	"rateLimitHelpers":   rateLimitHelpers,
+	"corsHelpers":        corsHelpers,
+	"options":            optionsTemplate,
+	"router":             routerTemplate,
+	"wrapper":            wrapperTemplate,
+	"validator":          validatorTemplate,
+	"mux":                muxTemplate,
+	"clientErrors":       clientErrorsTemplate,
+	"clientHelpers":      clientHelpersTemplate,
+	"client":             clientTemplate,
+}
+
+// envelopeTemplate declares the response envelope and the functions writing it, data is EnvelopeConfig
+const envelopeTemplate = `type DefaultResponseWrapper struct {
+	Error    string            ` + "`json:\"{{.Error}}\"`" + `
+	Response interface{}       ` + "`json:\"{{.Response}},omitempty\"`" + `
+	Fields   map[string]string ` + "`json:\"{{.Fields}},omitempty\"`" + `
+}
+
+// apigenWriteError writes the error in the envelope, validation errors list invalid fields
+func apigenWriteError(w http.ResponseWriter, status int, err error) {
+	response := DefaultResponseWrapper{}
+	response.Error = err.Error()
+	if e, ok := err.(ApiError); ok {
+		if ve, ok := e.Err.(ValidationError); ok {
+			response.Fields = ve.Fields
+		}
+	}
+	payload, _ := json.Marshal(response)
+	w.WriteHeader(status)
+	w.Write(payload)
+}
+
+func apigenWriteResponse(w http.ResponseWriter, res interface{}) {
+	response := DefaultResponseWrapper{}
+	response.Response = res
+	payload, _ := json.Marshal(response)
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+`
+
+// routerTemplate writes the handler of the receiver and ServeHTTP using it, data is routerData
+const routerTemplate = `// {{.Receiver}}Handler serves endpoints of {{.Receiver}} wrapped with middleware of its options
+type {{.Receiver}}Handler struct {
+	srv *{{.Receiver}}
+	// endpoints are indexed by routes, paths answer requests of urls no endpoint serves
+	endpoints []http.Handler
+	paths     []http.Handler
+	notFound  http.Handler
+{{- if .RateLimits}}
+	limiter   Limiter
+{{- end}}
+}
+
+// New{{.Receiver}}Handler serves srv, options are applied in order
+func New{{.Receiver}}Handler(srv *{{.Receiver}}, opts ...Option) *{{.Receiver}}Handler {
+	o := apigenNewOptions(opts)
+	h := &{{.Receiver}}Handler{srv: srv{{if .RateLimits}}, limiter: apigenNewLimiter(srv, o){{end}}}
+	h.endpoints = []http.Handler{
+{{- range .Paths}}{{range .Routes}}
+		o.wrap(Endpoint{Receiver: {{quote .ReceiverTypeName}}, FuncName: {{quote .FuncName}}, URL: {{quote .Url}}, {{with .FuncGeneratorDescription.Methods}}Methods: []string{ {{- quoteList . -}} }, {{end}}Auth: {{.Auth}}, Handler: http.HandlerFunc(h.serve{{.FuncName}})}),
+{{- end}}{{end}}
+	}
+	h.paths = []http.Handler{
+{{- range .Paths}}{{if ge .Fallback 0}}
+		o.wrap(Endpoint{Receiver: {{quote $.Receiver}}, URL: {{quote .Url}}, {{with .Methods}}Methods: []string{ {{- quoteList . -}} }, {{end}}Handler: http.HandlerFunc(h.servePath{{.Fallback}})}),
+{{- end}}{{end}}
+	}
+	h.notFound = o.wrap(Endpoint{Receiver: {{quote .Receiver}}, Handler: o.notFound})
+	return h
+}
+
+// ServeHTTP serves the request without options and keeps no state between requests,
+{{- if .RateLimits}} rate limits
+// are checked only when srv implements Limiter,{{end}} New{{.Receiver}}Handler builds a handler owned by the caller
+func (srv *{{.Receiver}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	New{{.Receiver}}Handler(srv{{if .RateLimits}}, WithLimiter(apigenStatelessLimiter(srv)){{end}}).ServeHTTP(w, r)
+}
+
+func (h *{{.Receiver}}Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+{{- range .Paths}}{{if not .Templated}}
+	case {{quote .Url}}:
+{{- template "path" .}}
+{{- end}}{{end}}
+	default:
+{{- range .Paths}}{{if .Templated}}
+		if params, ok := apigenMatchPath({{quote .Url}}, r.URL.EscapedPath()); ok {
+			r = r.WithContext(context.WithValue(r.Context(), apigenPathParamsKey{}, params))
+{{- template "path" .}}
+			return
+		}
+{{- end}}{{end}}
+		h.notFound.ServeHTTP(w, r)
+	}
+}
+{{- range .Paths}}{{range .Routes}}
+
+// serve{{.FuncName}} checks the request before the call of {{.FuncName}}
+func (h *{{$.Receiver}}Handler) serve{{.FuncName}}(w http.ResponseWriter, r *http.Request) {
+	srv := h.srv
+{{- template "route" .}}
+}
+{{- end}}{{end}}
+{{- range .Paths}}{{if ge .Fallback 0}}
+
+// servePath{{.Fallback}} answers requests of {{.Url}} no endpoint serves{{if .Preflight}}: preflight requests{{if not .Any}},{{end}}{{else}}:{{end}}
+{{- if not .Any}}{{if not .ExplicitOptions}} OPTIONS requests and{{end}} methods the url does not accept{{end}}
+func (h *{{$.Receiver}}Handler) servePath{{.Fallback}}(w http.ResponseWriter, r *http.Request) {
+{{- if .Preflight}}
+	if apigenIsPreflight(r) {
+{{- if .Any}}
+		{{(index .Routes 0).CORSVar}}.preflight(w, r, "")
+{{- else}}
+		switch r.Header.Get("Access-Control-Request-Method") {
+{{- range .Routes}}{{if .CORSVar}}
+		case {{quoteList .Methods}}:
+			{{.CORSVar}}.preflight(w, r, {{quote .AllowMethods}})
+{{- end}}{{end}}
+		default:
+			w.Header().Set("Allow", {{quote .Allow}})
+			w.WriteHeader(http.StatusNoContent)
+		}
+{{- end}}
+		return
+	}
+{{- end}}
+{{- if not .Any}}
+{{- if not .ExplicitOptions}}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", {{quote .Allow}})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+{{- end}}
+	w.Header().Set("Allow", {{quote .Allow}})
+	apigenWriteError(w, http.StatusMethodNotAllowed, errors.New("bad method"))
+{{- end}}
+}
+{{- end}}{{end}}
+{{- define "path"}}
+{{- if .Preflight}}
+		if apigenIsPreflight(r) {
+			h.paths[{{.Fallback}}].ServeHTTP(w, r)
+			return
+		}
+{{- end}}
+{{- if .Any}}
+		h.endpoints[{{(index .Routes 0).Index}}].ServeHTTP(w, r)
+{{- else}}
+		switch r.Method {
+{{- range .Routes}}
+		case {{quoteList .Methods}}:
+			h.endpoints[{{.Index}}].ServeHTTP(w, r)
+{{- end}}
+		default:
+			h.paths[{{.Fallback}}].ServeHTTP(w, r)
+		}
+{{- end}}
+{{- end}}
+{{- define "route"}}
+{{- if .CORSVar}}
+	{{.CORSVar}}.allowOrigin(w, r)
+{{- end}}
+{{- with .RateLimit}}{{if not .AfterAuth}}{{template "rateLimit" .}}{{end}}{{end}}
+{{- if .Auth}}
+	ctx, err := Authenticator(srv).Authenticate(r)
+	if err != nil {
+		status := http.StatusUnauthorized
+		var e ApiError
+		if errors.As(err, &e) {
+			status = e.HTTPStatus
+		}
+		apigenWriteError(w, status, err)
+		return
+	}
+	if ctx == nil {
+		ctx = r.Context()
+	}
+	r = r.WithContext(ctx)
+{{- end}}
+{{- if .Roles}}
+	roles, err := RoleResolver(srv).Roles(ctx)
+	if err == nil && !apigenHasAny(roles, {{quoteList .Roles}}) {
+		err = ApiError{http.StatusForbidden, errors.New("forbidden")}
+	}
+{{- template "accessDenied"}}
+{{- end}}
+{{- if .Scopes}}
+	scopes, err := ScopeResolver(srv).Scopes(ctx)
+	if err == nil && !apigenHasAll(scopes, {{quoteList .Scopes}}) {
+		err = ApiError{http.StatusForbidden, errors.New("forbidden")}
+	}
+{{- template "accessDenied"}}
+{{- end}}
+{{- with .RateLimit}}{{if .AfterAuth}}{{template "rateLimit" .}}{{end}}{{end}}
+	srv.Wrap{{.FuncName}}(w, r)
+{{- end}}
+{{- define "rateLimit"}}
+	if !apigenAllow(w, r, h.limiter, {{quote .Endpoint}}, {{.Limit}}, {{.Caller}}) {
+		return
+	}
+{{- end}}
+{{- define "accessDenied"}}
+	if err != nil {
+		status := http.StatusForbidden
+		var e ApiError
+		if errors.As(err, &e) {
+			status = e.HTTPStatus
+		}
+		apigenWriteError(w, status, err)
+		return
+	}
+{{- end}}
+`
+
+// optionsTemplate declares middleware and options shared by handlers of receivers and Router, data is optionsData
+const optionsTemplate = `// Endpoint is an annotated method as middleware sees it, Handler answers the request
+// from the start: CORS, rate limits, authentication, roles and scopes precede the call.
+// FuncName is empty for requests no method serves: preflight and OPTIONS requests,
+// methods the url does not accept and unknown paths, the latter also have empty URL
+type Endpoint struct {
+	Receiver string
+	FuncName string
+	// URL is the annotated url without prefix of the receiver
+	URL string
+	// Methods are accepted by the endpoint or the url, any method when empty
+	Methods []string
+	Auth    bool
+	Handler http.Handler
+}
+
+// Middleware wraps the handler of the endpoint
+type Middleware func(Endpoint) Endpoint
+
+// Option configures handlers of receivers and Router
+type Option func(*apigenOptions)
+
+type apigenOptions struct {
+	middleware []Middleware
+	notFound   http.Handler
+{{- if .RateLimits}}
+	limiter    Limiter
+{{- end}}
+}
+
+// Use wraps every endpoint with middleware, the first one is the outermost,
+// middleware of several Use options is applied in the order of options
+func Use(mw ...Middleware) Option {
+	return func(o *apigenOptions) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// WithNotFound replaces the handler of paths no endpoint serves
+func WithNotFound(h http.Handler) Option {
+	return func(o *apigenOptions) {
+		o.notFound = h
+	}
+}
+
+func apigenNewOptions(opts []Option) *apigenOptions {
+	o := &apigenOptions{
+		notFound: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apigenWriteError(w, http.StatusNotFound, errors.New("unknown method"))
+		}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// wrap applies middleware to the endpoint, the first one is the outermost
+func (o *apigenOptions) wrap(ep Endpoint) http.Handler {
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		ep = o.middleware[i](ep)
+	}
+	return ep.Handler
+}
+
+`
+
+// wrapperTemplate writes Wrap method of the endpoint, data is wrapperData
+const wrapperTemplate = `func (srv *{{.ReceiverTypeName}}) Wrap{{.FuncName}}(w http.ResponseWriter, r *http.Request) {
+	defer apigenRecover(w, r, srv, {{quote .FuncName}})
+	ctx := r.Context()
+{{- if .Timeout}}
+	ctx, cancel := context.WithTimeout(ctx, {{.Timeout}})
+	defer cancel()
+{{- end}}
+	inParam := {{.InputBusinessParamName}}{}
+	err := {{.ValidateCall}}
+	var e ApiError
+	if errors.As(err, &e) {
+		apigenWriteError(w, e.HTTPStatus, e)
+		return
+	} else if err != nil {
+		// errors of validation are caused by the request
+		apigenWriteError(w, http.StatusBadRequest, err)
+		return
+	}
+{{- if .Timeout}}
+	res, err := apigenCallTimeout(ctx, func() (interface{}, error) {
+		return srv.{{.FuncName}}(ctx, inParam)
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		apigenWriteError(w, http.StatusGatewayTimeout, errors.New("timeout"))
+		return
+	}
+{{- else}}
+	res, err := srv.{{.FuncName}}(ctx, inParam)
+{{- end}}
+	if errors.As(err, &e) {
+		apigenWriteError(w, e.HTTPStatus, e)
+		return
+	} else if err != nil {
+		apigenWriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	apigenWriteResponse(w, res)
+}
+`
+
+// validatorTemplate fills parameters struct from the request, data is ParamsStruct
+const validatorTemplate = `{{if .Local -}}
+// ValidateParams fills the struct from the request, it stops at the first invalid field
+func (srv *{{.TypeName}}) ValidateParams(r *http.Request) error {
+	return srv.apigenValidate(r, false)
+}
+
+func (srv *{{.TypeName}}) apigenValidate(r *http.Request, collect bool) error {
+{{- else -}}
+func {{.ValidateFunc}}(srv *{{.TypeName}}, r *http.Request, collect bool) error {
+{{- end}}
+{{- if .ReadsParams}}
+	params, err := apigenReadParams(r)
+	if err != nil {
+		return err
+	}
+{{- end}}
+	errs := &apigenFieldErrors{collect: collect}
+{{- range .Fields}}
+	if err := func() error {
+{{- template "validatorField" .}}
+		return nil
+	}(); err != nil {
+		if err := errs.add({{quote .FormName}}, err); err != nil {
+			return err
+		}
+	}
+{{- end}}
+	return errs.err()
+}
+{{- define "validatorField"}}
+{{- if .IsSlice}}
+		{{.VarName}}, err := params.values({{quote .FormName}}, {{quote .JSONKey}}, {{quote .Scalar}}, {{.Attr.CommaSeparated}})
+		if err != nil {
+			return err
+		}
+{{- if .Attr.IsRequired}}
+		if len({{.VarName}}) == 0 {
+			return ApiError{http.StatusBadRequest, fmt.Errorf("%s must me not empty", {{quote .FormName}})}
+		}
+{{- end}}
+{{- if .Attr.DefaultValue}}
+		if len({{.VarName}}) == 0 {
+			{{.VarName}} = []string{ {{- quoteList (split .Attr.DefaultValue "|") -}} }
+		}
+{{- end}}
+{{- if .Attr.MinItems}}
+		if len({{.VarName}}) < {{.Attr.MinItems}} {
+			return ApiError{http.StatusBadRequest, fmt.Errorf("%s must have at least %d items", {{quote .FormName}}, {{.Attr.MinItems}})}
+		}
+{{- end}}
+{{- if .Attr.HasMaxItems}}
+		if len({{.VarName}}) > {{.Attr.MaxItems}} {
+			return ApiError{http.StatusBadRequest, fmt.Errorf("%s must have at most %d items", {{quote .FormName}}, {{.Attr.MaxItems}})}
+		}
+{{- end}}
+{{- if .Attr.Unique}}
+		if dup, ok := apigenDuplicate({{.VarName}}); ok {
+			return ApiError{http.StatusBadRequest, fmt.Errorf("%s items must be unique, %s is repeated", {{quote .FormName}}, dup)}
+		}
+{{- end}}
+		srv.{{.Name}} = make({{.TypeName}}, 0, len({{.VarName}}))
+		for _, {{.VarName}}Item := range {{.VarName}} {
+{{- template "validatorValue" (value . (print .VarName "Item") .ElemTypeName (print "srv." .Name " = append(srv." .Name ", %s)"))}}
+		}
+{{- else}}
+{{- if .Attr.PathName}}
+		{{.VarName}} := apigenPathParam(r, {{quote .FormName}})
+{{- else}}
+		{{.VarName}}, err := params.value({{quote .FormName}}, {{quote .JSONKey}}, {{quote .Scalar}})
+		if err != nil {
+			return err
+		}
+{{- end}}
+{{- if .Attr.IsRequired}}
+		if {{.VarName}} == "" {
+			return ApiError{http.StatusBadRequest, fmt.Errorf("%s must me not empty", {{quote .FormName}})}
+		}
+{{- end}}
+{{- if .Attr.DefaultValue}}
+		if {{.VarName}} == "" {
+			{{.VarName}} = {{quote .Attr.DefaultValue}}
+		}
+{{- end}}
+{{- if eq .Kind "string"}}
+{{- template "validatorValue" (value . .VarName .TypeName (print "srv." .Name " = %s"))}}
+{{- else}}
+		if {{.VarName}} != "" {
+{{- template "validatorValue" (value . .VarName .TypeName (print "srv." .Name " = %s"))}}
+		}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- define "validatorValue"}}
+{{- if ne .Field.Kind "bool"}}{{if .Field.Attr.EnumValues}}
+			if !apigenInEnum({{.Var}}, {{quoteList .Field.Attr.EnumValues}}) {
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be one of [{{join .Field.Attr.EnumValues ", "}}]", {{quote .Field.FormName}})}
+			}
+{{- end}}{{end}}
+{{- if eq .Field.Kind "string"}}
+{{- if .Field.Attr.HasMin}}
+			if len({{.Var}}) < {{limit .Field.Attr.Min}} {
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s len must be >= %d", {{quote .Field.FormName}}, {{limit .Field.Attr.Min}})}
+			}
+{{- end}}
+{{- if .Field.Attr.HasMax}}
+			if len({{.Var}}) > {{limit .Field.Attr.Max}} {
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s len must be <= %d", {{quote .Field.FormName}}, {{limit .Field.Attr.Max}})}
+			}
+{{- end}}
+			{{printf .Assign .Converted}}
+{{- else if eq .Field.Kind "bool"}}
+			switch {{.Var}} {
+			case "true", "1":
+				{{printf .Assign "true"}}
+			case "false", "0":
+				{{printf .Assign "false"}}
+			default:
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be bool", {{quote .Field.FormName}})}
+			}
+{{- else}}
+{{- if eq .Field.Kind "int"}}
+			{{.Parsed}}, err := strconv.ParseInt({{.Var}}, 10, {{.Field.Bits}})
+{{- else if eq .Field.Kind "uint"}}
+			{{.Parsed}}, err := strconv.ParseUint({{.Var}}, 10, {{.Field.Bits}})
+{{- else}}
+			{{.Parsed}}, err := strconv.ParseFloat({{.Var}}, {{.Field.Bits}})
+{{- end}}
+			if err != nil {
+				return apigenParseError({{quote .Field.FormName}}, {{quote .Field.Scalar}}, err)
+			}
+{{- if .Field.Attr.HasMin}}
+			if {{.Parsed}} < {{limit .Field.Attr.Min}} {
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be >= %v", {{quote .Field.FormName}}, {{limit .Field.Attr.Min}})}
+			}
+{{- end}}
+{{- if .Field.Attr.HasMax}}
+			if {{.Parsed}} > {{limit .Field.Attr.Max}} {
+				return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be <= %v", {{quote .Field.FormName}}, {{limit .Field.Attr.Max}})}
+			}
+{{- end}}
+			{{printf .Assign (print .TypeName "(" .Parsed ")")}}
+{{- end}}
+{{- end}}
+`
+
+// muxTemplate writes Router composing receivers under their prefixes, data is muxData
+const muxTemplate = `// Router serves every receiver under its prefix, the path is matched before
+// the request is passed to the receiver without the prefix
+type Router struct {
+{{- range .Receivers}}
+	{{.Var}} http.Handler
+{{- end}}
+	notFound http.Handler
+}
+
+// NewRouter composes handlers of the receivers built with the options
+func NewRouter({{range .Receivers}}{{.Var}} *{{.Name}}, {{end}}opts ...Option) *Router {
+	o := apigenNewOptions(opts)
+	return &Router{
+{{- range .Receivers}}
+		{{.Var}}: {{if .Prefix}}http.StripPrefix({{quote .Prefix}}, New{{.Name}}Handler({{.Var}}, opts...)){{else}}New{{.Name}}Handler({{.Var}}, opts...){{end}},
+{{- end}}
+		notFound: o.wrap(Endpoint{Handler: o.notFound}),
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+{{- range .Receivers}}{{if .Paths}}
+	case {{quoteList .Paths}}:
+		rt.{{.Var}}.ServeHTTP(w, r)
+{{- end}}{{end}}
+	default:
+{{- if .Templated}}
+		path := r.URL.EscapedPath()
+{{- range .Receivers}}{{if .Templates}}
+		for _, pattern := range []string{ {{- quoteList .Templates -}} } {
+			if _, ok := apigenMatchPath(pattern, path); ok {
+				rt.{{.Var}}.ServeHTTP(w, r)
+				return
+			}
+		}
+{{- end}}{{end}}
+{{- end}}
+		rt.notFound.ServeHTTP(w, r)
+	}
+}
+`
+
+// optionsData is passed to the options template
+type optionsData struct {
+	// RateLimits is set when some endpoint has rate limit
+	RateLimits bool
+}
+
+// routerData is passed to the router template
+type routerData struct {
+	Receiver string
+	Paths    []pathData
+	// RateLimits is set when some endpoint of the receiver has rate limit
+	RateLimits bool
+}
+
+// pathData is a url with endpoints serving its methods
+type pathData struct {
+	Url       string
+	Templated bool
+	// Any is set when the only endpoint accepts any method
+	Any    bool
+	Routes []routeData
+	// Allow is the value of Allow header of 405 and OPTIONS responses, Methods lists it
+	Allow   string
+	Methods []string
+	// ExplicitOptions is set when some endpoint serves OPTIONS itself
+	ExplicitOptions bool
+	// Preflight is set when some endpoint has CORS
+	Preflight bool
+	// Fallback indexes the handler of requests no endpoint of the url serves, -1 without one
+	Fallback int
+}
+
+type routeData struct {
+	FuncGeneratorDescription
+	// Index is the position of the endpoint in the handler of the receiver
+	Index int
+	// Methods are matched by the route, HEAD is added to GET
+	Methods   []string
+	RateLimit *rateLimitData
+	// CORSVar names CORS of the endpoint, AllowMethods are answered to its preflight requests
+	CORSVar      string
+	AllowMethods string
+}
+
+// wrapperData is passed to the wrapper template
+type wrapperData struct {
+	FuncGeneratorDescription
+	// ValidateCall is go expression filling inParam from the request
+	ValidateCall string
+	// Timeout is go expression of the deadline of the call, empty without one
+	Timeout string
+}
+
+// valueData describes parsing of a single value in the validator template
+type valueData struct {
+	Field ParamField
+	// Var holds the raw value, it is converted to TypeName and written with Assign format
+	Var      string
+	TypeName string
+	Assign   string
+}
+
+// Parsed is the name of the variable with parsed number
+func (v valueData) Parsed() string {
+	return "apigenParsed"
+}
+
+// Converted is the raw string value converted to the named string type
+func (v valueData) Converted() string {
+	if v.TypeName == v.Field.Scalar {
+		return v.Var
+	}
+	return v.TypeName + "(" + v.Var + ")"
+}
+
+// FormName is the name of the request parameter the field is bound to
+func (f ParamField) FormName() string {
+	return paramFieldName(f)
+}
+
+// JSONKey is the name of the field in JSON body
+func (f ParamField) JSONKey() string {
+	if f.Attr.JSONName != "" {
+		return f.Attr.JSONName
+	}
+	if f.Attr.ParamName != "" {
+		return f.Attr.ParamName
+	}
+	return strings.ToLower(f.Name)
+}
+
+// VarName is the name of the variable with the raw value, every field is validated in its own
+// function, so names are reserved instead of taken from fields which may shadow names the code uses
+func (f ParamField) VarName() string {
+	return "apigenValue"
+}
+
+// Kind is one of string, bool, int, uint and float
+func (f ParamField) Kind() string {
+	return scalarTypes[f.Scalar].kind
+}
+
+// Bits is bitSize of the strconv parse function
+func (f ParamField) Bits() int {
+	return scalarTypes[f.Scalar].bits
+}
+
+// ReadsParams reports whether some fields are taken from the form or JSON body
+func (ps *ParamsStruct) ReadsParams() bool {
+	for _, filed := range ps.Fields {
+		if filed.Attr.PathName == "" {
+			return true
+		}
+	}
+	return false
+}
+
+var templateFuncs = template.FuncMap{
+	"quote":     strconv.Quote,
+	"quoteList": quoteList,
+	"split":     strings.Split,
+	"join":      strings.Join,
+	"limit":     formatLimit,
+	// clientValue converts the value to string in the client
+	"clientValue": formatClientValue,
+	"value": func(filed ParamField, varName string, typeName string, assign string) valueData {
+		return valueData{Field: filed, Var: varName, TypeName: typeName, Assign: assign}
+	},
+}
+
+// loadTemplates parses default templates, the ones found in dir replace them
+func loadTemplates(dir string) (*template.Template, error) {
+	root := template.New("apigen").Funcs(templateFuncs)
+	for _, name := range TemplateNames {
+		text := defaultTemplates[name]
+		if dir != "" {
+			fileName := filepath.Join(dir, name+".tmpl")
+			data, err := ioutil.ReadFile(fileName)
+			if err == nil {
+				text = string(data)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		if _, err := root.New(name).Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// executeTemplate writes the template followed by an empty line
+func executeTemplate(out io.Writer, tmpl *template.Template, name string, data interface{}) error {
+	if err := tmpl.ExecuteTemplate(out, name, data); err != nil {
+		return fmt.Errorf("template %s: %v", name, err)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,126 @@
+package apigen
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// customEnvelope replaces the envelope with one keeping only the error text
+const customEnvelope = `// DefaultResponseWrapper is the custom envelope
+type DefaultResponseWrapper struct {
+	Error    string      ` + "`json:\"message\"`" + `
+	Response interface{} ` + "`json:\"data,omitempty\"`" + `
+}
+
+func apigenWriteError(w http.ResponseWriter, status int, err error) {
+	payload, _ := json.Marshal(DefaultResponseWrapper{Error: err.Error()})
+	w.WriteHeader(status)
+	w.Write(payload)
+}
+
+func apigenWriteResponse(w http.ResponseWriter, res interface{}) {
+	payload, _ := json.Marshal(DefaultResponseWrapper{Response: res})
+	w.Write(payload)
+}
+`
+
+// usersModel is loaded once, type checking its imports takes most of the time of tests
+var usersModel *Model
+
+func generateHandlers(t *testing.T, opts Options) (string, error) {
+	t.Helper()
+	if usersModel == nil {
+		m, err := Load(filepath.Join("testdata", "users"))
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		usersModel = m
+	}
+	buf := &bytes.Buffer{}
+	err := Generate(usersModel, buf, opts)
+	return buf.String(), err
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"envelope.tmpl": customEnvelope,
+		// вспомогательные шаблоны заменяются так же
+		"panicHelpers.tmpl": strings.Replace(panicHelpers, "// PanicHandler may be implemented", "// PanicHandler of the custom template may be implemented", 1),
+	})
+
+	out, err := generateHandlers(t, Options{Templates: dir})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, text := range []string{"// DefaultResponseWrapper is the custom envelope", "`json:\"message\"`", "// PanicHandler of the custom template"} {
+		if !strings.Contains(out, text) {
+			t.Errorf("output has no %q of the replaced templates", text)
+		}
+	}
+	// остальные шаблоны встроенные
+	if !strings.Contains(out, "func (srv *UserApi) WrapProfile(w http.ResponseWriter, r *http.Request) {") {
+		t.Errorf("output has no wrapper of the built-in template")
+	}
+	typeCheckGenerated(t, filepath.Join("testdata", "users"), out)
+}
+
+func TestValidatorNames(t *testing.T) {
+	// поля с именами переменных и встроенных функций сгенерированного кода
+	dir := writePackage(t, map[string]string{"api.go": fixtureHeader + `
+type Q struct {
+	Type    string   ` + "`apivalidator:\"required\"`" + `
+	Err     int      ` + "`apivalidator:\"min=1\"`" + `
+	Srv     string
+	Params  string
+	Default bool
+	Range   uint8
+	Map     float64
+	Len     []string
+	Append  []int
+	Make    string   ` + "`apivalidator:\"path=make\"`" + `
+}
+
+// apigen:api {"url": "/q/{make}"}
+func (s *S) Query(ctx context.Context, in Q) (*R, error) { return nil, nil }
+`})
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := Generate(m, buf, Options{}); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	typeCheckGenerated(t, dir, buf.String())
+}
+
+func TestTemplateErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"router.tmpl", "{{.Receiver", "unclosed action"},
+		{"wrapper.tmpl", "{{.NoSuchField}}", "template wrapper:"},
+	}
+	for _, item := range cases {
+		dir := writePackage(t, map[string]string{item.name: item.template})
+		_, err := generateHandlers(t, Options{Templates: dir})
+		if err == nil || !strings.Contains(err.Error(), item.expected) {
+			t.Errorf("[%s] expected error with %q, got %v", item.name, item.expected, err)
+		}
+	}
+}
+
+func TestTemplateNames(t *testing.T) {
+	for _, name := range TemplateNames {
+		if defaultTemplates[name] == "" {
+			t.Errorf("template %s has no default", name)
+		}
+	}
+	if len(TemplateNames) != len(defaultTemplates) {
+		t.Errorf("TemplateNames and defaultTemplates differ")
+	}
+}
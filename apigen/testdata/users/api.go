@@ -0,0 +1,56 @@
+package users
+
+import (
+	"context"
+	"net/http"
+)
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+// apigen:api {"prefix": "/v1"}
+type UserApi struct{}
+
+func (srv *UserApi) Authenticate(r *http.Request) (context.Context, error) {
+	return r.Context(), nil
+}
+
+type ProfileParams struct {
+	Login string `apivalidator:"required"`
+}
+
+type CreateParams struct {
+	Login  string `apivalidator:"required,min=3"`
+	Age    int    `apivalidator:"min=0,max=128"`
+	Status string `apivalidator:"enum=user|admin,default=user"`
+}
+
+type PathParams struct {
+	ID int `apivalidator:"path=id"`
+}
+
+type User struct {
+	ID    uint64 `json:"id"`
+	Login string `json:"login"`
+}
+
+// apigen:api {"url": "/user/profile", "auth": false}
+func (srv *UserApi) Profile(ctx context.Context, in ProfileParams) (*User, error) {
+	return &User{Login: in.Login}, nil
+}
+
+// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}
+func (srv *UserApi) Create(ctx context.Context, in CreateParams) (*User, error) {
+	return &User{ID: 1, Login: in.Login}, nil
+}
+
+// apigen:api {"url": "/user/{id:int}", "auth": false, "method": ["GET", "DELETE"]}
+func (srv *UserApi) ByID(ctx context.Context, in PathParams) (*User, error) {
+	return &User{ID: uint64(in.ID)}, nil
+}
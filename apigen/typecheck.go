@@ -0,0 +1,405 @@
+package apigen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checkPackage type checks parsed files of the package in dir, errors are ignored as the package
+// usually refers to the code which is not generated yet, imports which fail are added to diagnostics
+func checkPackage(fset *token.FileSet, d *diagnostics, dir string, tags []string, files []*ast.File) (*types.Package, *types.Info) {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer: newSourceImporter(fset, dir, tags),
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok && strings.HasPrefix(e.Msg, "could not import ") {
+				d.errorf(e.Pos, "%s", e.Msg)
+			}
+		},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, info)
+	return pkg, info
+}
+
+// sourceImporter type checks imported packages from source, the go command looks for them
+// from the directory of the loaded package, so imports of its module are found wherever the generator runs
+type sourceImporter struct {
+	ctxt     build.Context
+	fset     *token.FileSet
+	packages map[string]*types.Package
+}
+
+func newSourceImporter(fset *token.FileSet, dir string, tags []string) *sourceImporter {
+	ctxt := build.Default
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	ctxt.Dir = dir
+	ctxt.BuildTags = tags
+	// only declarations are needed, pure go files of cgo packages declare them without running cgo
+	ctxt.CgoEnabled = false
+	return &sourceImporter{ctxt: ctxt, fset: fset, packages: make(map[string]*types.Package)}
+}
+
+func (si *sourceImporter) Import(path string) (*types.Package, error) {
+	return si.ImportFrom(path, si.ctxt.Dir, 0)
+}
+
+func (si *sourceImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if abs, err := filepath.Abs(srcDir); err == nil {
+		srcDir = abs
+	}
+	bp, err := si.ctxt.Import(path, srcDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if bp.ImportPath == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := si.packages[bp.ImportPath]; ok {
+		if pkg == nil {
+			return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
+		}
+		return pkg, nil
+	}
+
+	// nil marks the package being imported
+	si.packages[bp.ImportPath] = nil
+	files := []*ast.File{}
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(si.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			delete(si.packages, bp.ImportPath)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	var firstErr error
+	conf := types.Config{
+		IgnoreFuncBodies: true,
+		Importer:         si,
+		Sizes:            types.SizesFor(si.ctxt.Compiler, si.ctxt.GOARCH),
+		Error: func(err error) {
+			if e, ok := err.(types.Error); ok && !e.Soft && firstErr == nil {
+				firstErr = err
+			}
+		},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, si.fset, files, nil)
+	if firstErr != nil {
+		delete(si.packages, bp.ImportPath)
+		return nil, fmt.Errorf("type checking package %q failed: %v", bp.ImportPath, firstErr)
+	}
+	si.packages[bp.ImportPath] = pkg
+	return pkg, nil
+}
+
+// qualifier writes names of other packages and records their imports
+func qualifier(pkg *types.Package, imports map[string]string) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		imports[other.Path()] = other.Name()
+		return other.Name()
+	}
+}
+
+// sortedImports returns quoted paths of imports
+func sortedImports(imports ...map[string]string) []string {
+	res := []string{}
+	seen := make(map[string]bool)
+	for _, list := range imports {
+		for path := range list {
+			if !seen[path] {
+				seen[path] = true
+				res = append(res, strconv.Quote(path))
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// checkSignature verifies that the method looks like
+// func (srv *Recv) Name(ctx context.Context, in Params) (*Result, error)
+// and fills receiver, parameters and result of the description, problems are added to diagnostics
+func (m *Model) checkSignature(d *diagnostics, pkg *types.Package, info *types.Info, g *ast.FuncDecl, desc *FuncGeneratorDescription) bool {
+	errorf := func(pos token.Pos, format string, args ...interface{}) bool {
+		d.errorf(pos, "method %s: %s", g.Name.Name, fmt.Sprintf(format, args...))
+		return false
+	}
+	obj, ok := info.Defs[g.Name].(*types.Func)
+	if !ok {
+		return errorf(g.Pos(), "cannot be type checked")
+	}
+	sig := obj.Type().(*types.Signature)
+
+	recv := namedType(sig.Recv().Type())
+	if recv == nil {
+		return errorf(g.Recv.Pos(), "receiver must be a named type, got %s", sig.Recv().Type())
+	}
+	desc.ReceiverTypeName = recv.Obj().Name()
+	// generated handlers convert the receiver to interfaces of the annotation
+	for _, method := range desc.receiverMethods() {
+		if !hasMethod(recv, method.name, method.signature) {
+			return errorf(desc.pos, "%s needs method %s of *%s", method.annotation, method.text, recv.Obj().Name())
+		}
+	}
+
+	params := sig.Params()
+	if params.Len() != 2 {
+		return errorf(g.Type.Params.Pos(), "must have parameters (context.Context, Params), got %d parameters", params.Len())
+	}
+	if !isContext(params.At(0).Type()) {
+		return errorf(g.Type.Params.List[0].Type.Pos(), "first parameter must be context.Context, got %s", params.At(0).Type())
+	}
+	paramsPos := params.At(1).Pos()
+	// aliases are resolved to the types they stand for
+	paramType, ok := types.Unalias(params.At(1).Type()).(*types.Named)
+	if !ok {
+		return errorf(paramsPos, "parameters must be a named struct type, got %s", params.At(1).Type())
+	}
+	if _, ok := paramType.Underlying().(*types.Struct); !ok {
+		return errorf(paramsPos, "parameters must be a struct, %s is %s", paramType, paramType.Underlying())
+	}
+
+	results := sig.Results()
+	if results.Len() != 2 {
+		pos := g.Type.Pos()
+		if g.Type.Results != nil {
+			pos = g.Type.Results.Pos()
+		}
+		return errorf(pos, "must return (*Result, error), got %d results", results.Len())
+	}
+	if !types.Identical(results.At(1).Type(), types.Universe.Lookup("error").Type()) {
+		return errorf(results.At(1).Pos(), "second result must be error, got %s", results.At(1).Type())
+	}
+	resultType := namedType(results.At(0).Type())
+	if resultType == nil {
+		return errorf(results.At(0).Pos(), "result must be a named type or a pointer to it, got %s", results.At(0).Type())
+	}
+	desc.OutputBusinessParamName = types.TypeString(resultType, qualifier(pkg, m.resultImports))
+	desc.resultType = resultType
+
+	ps, ok := m.loadParamsStruct(d, pkg, paramType)
+	if !ok {
+		return false
+	}
+	desc.InputBusinessParamName = ps.TypeName
+	return true
+}
+
+// receiverMethod is a method the annotation needs, signature is written with full package paths
+type receiverMethod struct {
+	annotation string
+	name       string
+	signature  string
+	// text is the method as it is declared
+	text string
+}
+
+// receiverMethods lists methods of interfaces the generated handler of the endpoint uses
+func (desc *FuncGeneratorDescription) receiverMethods() []receiverMethod {
+	res := []receiverMethod{}
+	if desc.Auth {
+		res = append(res, receiverMethod{"auth", "Authenticate", "func(*net/http.Request) (context.Context, error)", "Authenticate(r *http.Request) (context.Context, error)"})
+	}
+	if len(desc.Roles) > 0 {
+		res = append(res, receiverMethod{"roles", "Roles", "func(context.Context) ([]string, error)", "Roles(ctx context.Context) ([]string, error)"})
+	}
+	if len(desc.Scopes) > 0 {
+		res = append(res, receiverMethod{"scopes", "Scopes", "func(context.Context) ([]string, error)", "Scopes(ctx context.Context) ([]string, error)"})
+	}
+	return res
+}
+
+// hasMethod reports whether the pointer to the type has the method with the signature
+func hasMethod(recv *types.Named, name string, signature string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(recv), true, recv.Obj().Pkg(), name)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	tuple := func(list *types.Tuple) string {
+		names := []string{}
+		for i := 0; i < list.Len(); i++ {
+			names = append(names, types.TypeString(list.At(i).Type(), nil))
+		}
+		return strings.Join(names, ", ")
+	}
+	return "func("+tuple(sig.Params())+") ("+tuple(sig.Results())+")" == signature
+}
+
+// namedType returns named type or the type the pointer points to
+func namedType(t types.Type) *types.Named {
+	if ptr, ok := types.Unalias(t).(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, _ := types.Unalias(t).(*types.Named)
+	return named
+}
+
+func isContext(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// loadParamsStruct describes fields of the parameters struct, every struct is described once,
+// all invalid fields are reported
+func (m *Model) loadParamsStruct(d *diagnostics, pkg *types.Package, named *types.Named) (*ParamsStruct, bool) {
+	typeName := types.TypeString(named, qualifier(pkg, m.paramImports))
+	if ps, ok := m.params[typeName]; ok {
+		return ps, ps.valid
+	}
+	ps := &ParamsStruct{
+		TypeName: typeName,
+		Local:    named.Obj().Pkg() == pkg,
+	}
+	if !ps.Local {
+		ps.ValidateFunc = "apigenValidate" + upperFirst(named.Obj().Pkg().Name()) + named.Obj().Name()
+	}
+
+	st := named.Underlying().(*types.Struct)
+	ps.valid = true
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		errorf := func(format string, args ...interface{}) {
+			d.errorf(field.Pos(), "field %s.%s: %s", named.Obj().Name(), field.Name(), fmt.Sprintf(format, args...))
+			ps.valid = false
+		}
+		if field.Embedded() {
+			errorf("embedded fields are not supported")
+			continue
+		}
+		if !ps.Local && !field.Exported() {
+			errorf("unexported field of imported struct can not be filled")
+			continue
+		}
+
+		attr, err := parseValidateAttr(st.Tag(i))
+		if err != nil {
+			errorf("apivalidator: %v", err)
+			continue
+		}
+		pf := ParamField{
+			Name:     field.Name(),
+			TypeName: types.TypeString(field.Type(), qualifier(pkg, m.paramImports)),
+			Attr:     attr,
+		}
+		underlying := field.Type().Underlying()
+		if slice, ok := underlying.(*types.Slice); ok {
+			pf.IsSlice = true
+			pf.ElemTypeName = types.TypeString(slice.Elem(), qualifier(pkg, m.paramImports))
+			underlying = slice.Elem().Underlying()
+		}
+		basic, ok := underlying.(*types.Basic)
+		if !ok {
+			errorf("unsupported type %s", field.Type())
+			continue
+		}
+		pf.Scalar = types.Typ[basic.Kind()].Name()
+		if _, ok := scalarTypes[pf.Scalar]; !ok {
+			errorf("unsupported type %s", field.Type())
+			continue
+		}
+		if pf.IsSlice && pf.Attr.PathName != "" {
+			errorf("path parameter can not be bound to slice")
+			continue
+		}
+		if err := checkValidateAttr(pf); err != nil {
+			errorf("apivalidator: %v", err)
+			continue
+		}
+		ps.Fields = append(ps.Fields, pf)
+	}
+
+	m.params[typeName] = ps
+	m.Params = append(m.Params, ps)
+	return ps, ps.valid
+}
+
+// checkValidateAttr verifies that values of the tag can be compared with values of the field
+func checkValidateAttr(filed ParamField) error {
+	scalar := scalarTypes[filed.Scalar]
+	attr := filed.Attr
+	if attr.HasMin {
+		if err := checkNumberLimit(filed.Scalar, scalar, "min", attr.Min); err != nil {
+			return err
+		}
+	}
+	if attr.HasMax {
+		if err := checkNumberLimit(filed.Scalar, scalar, "max", attr.Max); err != nil {
+			return err
+		}
+	}
+	for _, val := range attr.EnumValues {
+		if !isScalarValue(scalar, val) {
+			return fmt.Errorf("enum value %q is not %s", val, filed.Scalar)
+		}
+	}
+	if attr.DefaultValue == "" {
+		return nil
+	}
+	defaults := []string{attr.DefaultValue}
+	if filed.IsSlice {
+		defaults = strings.Split(attr.DefaultValue, "|")
+	}
+	for _, val := range defaults {
+		if !isScalarValue(scalar, val) {
+			return fmt.Errorf("default value %q is not %s", val, filed.Scalar)
+		}
+	}
+	return nil
+}
+
+// checkNumberLimit rejects limits that cannot be compared with the parsed value
+func checkNumberLimit(filedType string, scalar scalarType, name string, val float64) error {
+	if scalar.kind == "bool" {
+		return fmt.Errorf("%s is not supported by bool fields", name)
+	}
+	if scalar.kind != "float" && val != float64(int64(val)) {
+		return fmt.Errorf("%s=%s is not an integer, field type is %s", name, formatLimit(val), filedType)
+	}
+	if scalar.kind == "uint" && val < 0 {
+		return fmt.Errorf("%s=%s is negative, field type is %s", name, formatLimit(val), filedType)
+	}
+	return nil
+}
+
+// isScalarValue reports whether the value of the tag is parsed by the generated code
+func isScalarValue(scalar scalarType, val string) bool {
+	var err error
+	switch scalar.kind {
+	case "bool":
+		return val == "true" || val == "1" || val == "false" || val == "0"
+	case "int":
+		_, err = strconv.ParseInt(val, 10, scalar.bits)
+	case "uint":
+		_, err = strconv.ParseUint(val, 10, scalar.bits)
+	case "float":
+		_, err = strconv.ParseFloat(val, scalar.bits)
+	}
+	return err == nil
+}
+
+// validateCall returns go expression validating the variable with parameters
+func (ps *ParamsStruct) validateCall(varName string, collect bool) string {
+	if ps.Local {
+		return varName + ".apigenValidate(r, " + strconv.FormatBool(collect) + ")"
+	}
+	return ps.ValidateFunc + "(&" + varName + ", r, " + strconv.FormatBool(collect) + ")"
+}
@@ -0,0 +1,26 @@
+package apigen
+
+// scalarType describes how values of the go type are parsed from the form
+type scalarType struct {
+	// kind is one of string, bool, int, uint and float
+	kind string
+	// bits is bitSize for strconv parse functions, 0 for int and uint
+	bits int
+}
+
+var scalarTypes = map[string]scalarType{
+	"string":  {"string", 0},
+	"bool":    {"bool", 0},
+	"int":     {"int", 0},
+	"int8":    {"int", 8},
+	"int16":   {"int", 16},
+	"int32":   {"int", 32},
+	"int64":   {"int", 64},
+	"uint":    {"uint", 0},
+	"uint8":   {"uint", 8},
+	"uint16":  {"uint", 16},
+	"uint32":  {"uint", 32},
+	"uint64":  {"uint", 64},
+	"float32": {"float", 32},
+	"float64": {"float", 64},
+}
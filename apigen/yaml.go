@@ -0,0 +1,271 @@
+package apigen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlMap is an ordered mapping, keys are written in the order they were added
+type yamlMap []yamlItem
+
+type yamlItem struct {
+	Key   string
+	Value interface{}
+}
+
+func (m yamlMap) with(key string, value interface{}) yamlMap {
+	return append(m, yamlItem{key, value})
+}
+
+// set replaces value of the existing key or adds a new one
+func (m yamlMap) set(key string, value interface{}) yamlMap {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return m.with(key, value)
+}
+
+func (m yamlMap) lookup(key string) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// encodeYAML renders maps, lists and scalars as a block style YAML document
+func encodeYAML(v interface{}) []byte {
+	buf := &bytes.Buffer{}
+	writeYAMLBlock(buf, v, 0, false)
+	return buf.Bytes()
+}
+
+// writeYAMLBlock writes a collection, inline means the first line continues the current one (list items)
+func writeYAMLBlock(buf *bytes.Buffer, v interface{}, indent int, inline bool) {
+	switch v := v.(type) {
+	case yamlMap:
+		for i, item := range v {
+			if !inline || i > 0 {
+				buf.WriteString(strings.Repeat("  ", indent))
+			}
+			buf.WriteString(yamlScalar(item.Key))
+			buf.WriteString(":")
+			writeYAMLChild(buf, item.Value, indent)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if !inline || i > 0 {
+				buf.WriteString(strings.Repeat("  ", indent))
+			}
+			buf.WriteString("-")
+			if isYAMLCollection(item) {
+				buf.WriteString(" ")
+				writeYAMLBlock(buf, item, indent+1, true)
+				continue
+			}
+			buf.WriteString(" " + yamlScalar(item) + "\n")
+		}
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, item)
+		}
+		writeYAMLBlock(buf, list, indent, inline)
+	default:
+		buf.WriteString(yamlScalar(v) + "\n")
+	}
+}
+
+func writeYAMLChild(buf *bytes.Buffer, v interface{}, indent int) {
+	if !isYAMLCollection(v) {
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+		return
+	}
+	buf.WriteString("\n")
+	writeYAMLBlock(buf, v, indent+1, false)
+}
+
+// isYAMLCollection reports whether v is a non empty map or list, empty ones are written in flow style
+func isYAMLCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case yamlMap:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case yamlMap:
+		return "{}"
+	case []interface{}, []string:
+		return "[]"
+	case string:
+		if yamlNeedsQuotes(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	panic("unsupported yaml value")
+}
+
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	return strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\t\\\"")
+}
+
+// yamlLine is a non empty line of YAML document without comments
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// decodeYAML reads block style mappings of scalars, the subset used by configuration files
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	lines := []yamlLine{}
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripYAMLComment(text), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can not be used for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{i + 1, len(text) - len(trimmed), trimmed})
+	}
+	res := make(map[string]interface{})
+	if len(lines) == 0 {
+		return res, nil
+	}
+	pos := 0
+	if err := decodeYAMLMapping(lines, &pos, lines[0].indent, res); err != nil {
+		return nil, err
+	}
+	if pos < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[pos].num)
+	}
+	return res, nil
+}
+
+// decodeYAMLMapping reads keys of the same indentation starting at pos
+func decodeYAMLMapping(lines []yamlLine, pos *int, indent int, res map[string]interface{}) error {
+	for *pos < len(lines) && lines[*pos].indent == indent {
+		line := lines[*pos]
+		*pos++
+		if strings.HasPrefix(line.text, "- ") || line.text == "-" {
+			return fmt.Errorf("line %d: lists are not supported", line.num)
+		}
+		idx := strings.Index(line.text, ":")
+		if idx == -1 || (idx+1 < len(line.text) && line.text[idx+1] != ' ') {
+			return fmt.Errorf("line %d: key: value expected", line.num)
+		}
+		key, err := decodeYAMLScalar(strings.TrimSpace(line.text[:idx]))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line.num, err)
+		}
+		name, ok := key.(string)
+		if !ok {
+			name = fmt.Sprint(key)
+		}
+		if _, ok := res[name]; ok {
+			return fmt.Errorf("line %d: duplicate key %s", line.num, name)
+		}
+		value := strings.TrimSpace(line.text[idx+1:])
+		if value != "" {
+			if res[name], err = decodeYAMLScalar(value); err != nil {
+				return fmt.Errorf("line %d: %v", line.num, err)
+			}
+			continue
+		}
+		// empty value is a nested mapping or null
+		if *pos < len(lines) && lines[*pos].indent > indent {
+			child := make(map[string]interface{})
+			if err := decodeYAMLMapping(lines, pos, lines[*pos].indent, child); err != nil {
+				return err
+			}
+			res[name] = child
+			continue
+		}
+		res[name] = nil
+	}
+	return nil
+}
+
+func decodeYAMLScalar(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{"):
+		return nil, fmt.Errorf("flow collections are not supported")
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes # comment which is not inside of quoted string
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || line[i-1] == ' '):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,71 @@
+package apigen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		expected map[string]interface{}
+		err      string
+	}{
+		{name: "empty", text: "", expected: map[string]interface{}{}},
+		{
+			name: "scalars",
+			text: "---\nstring: text # comment\nquoted: \"a # b\"\nsingle: 'it''s'\nnumber: 10\nflag: true\nnothing: ~\nempty:\n",
+			expected: map[string]interface{}{
+				"string": "text", "quoted": "a # b", "single": "it's", "number": float64(10),
+				"flag": true, "nothing": nil, "empty": nil,
+			},
+		},
+		{
+			name: "nested mappings",
+			text: "envelope:\n  error: message\n  nested:\n    deep: 1\nauth: false\n",
+			expected: map[string]interface{}{
+				"envelope": map[string]interface{}{
+					"error":  "message",
+					"nested": map[string]interface{}{"deep": float64(1)},
+				},
+				"auth": false,
+			},
+		},
+		{name: "tabs", text: "a:\n\tb: 1\n", err: "line 2: tabs can not be used for indentation"},
+		{name: "lists", text: "a:\n  - b\n", err: "line 2: lists are not supported"},
+		{name: "flow", text: "a: [1, 2]\n", err: "line 1: flow collections are not supported"},
+		{name: "duplicate", text: "a: 1\na: 2\n", err: "line 2: duplicate key a"},
+		{name: "no colon", text: "a\n", err: "line 1: key: value expected"},
+		{name: "indentation", text: "a:\n    b: 1\n  c: 2\n", err: "line 3: unexpected indentation"},
+		{name: "unterminated", text: "a: 'b\n", err: "line 1: unterminated string 'b"},
+	}
+	for _, item := range cases {
+		got, err := decodeYAML([]byte(item.text))
+		if item.err != "" {
+			if err == nil || err.Error() != item.err {
+				t.Errorf("[%s] expected error %q, got %v", item.name, item.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", item.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, item.expected) {
+			t.Errorf("[%s] unexpected result\nGot: %#v\nExpected: %#v", item.name, got, item.expected)
+		}
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Method = "POST"
+	doc, err := decodeYAML(cfg.YAML())
+	if err != nil {
+		t.Fatalf("YAML of the config does not decode: %v", err)
+	}
+	if doc["authHeader"] != "X-Auth" || doc["method"] != "POST" {
+		t.Errorf("unexpected decoded config %#v", doc)
+	}
+}
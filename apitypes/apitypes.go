@@ -0,0 +1,12 @@
+// Package apitypes содержит параметры и результаты, общие для нескольких сервисов
+package apitypes
+
+type Status string
+
+type CountParams struct {
+	Status Status `apivalidator:"required,enum=user|moderator|admin"`
+}
+
+type Count struct {
+	Total int `json:"total"`
+}
@@ -1,3 +1,3 @@
 module github.com/soypita/api-generator
 
-go 1.14
+go 1.22
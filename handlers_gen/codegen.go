@@ -1,360 +1,251 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"flag"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
+	"go/build"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
-	"reflect"
-	"strconv"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
-)
-
-type FuncGeneratorDescription struct {
-	receiverTypeName       string
-	inputBusinessParamName string
-	funcName               string
-	Url                    string `json:"url"`
-	Auth                   bool   `json:"auth"`
-	Method                 string `json:"method"`
-}
 
-type ValidateAttr struct {
-	paramName    string
-	isRequired   bool
-	enumValues   []string
-	defaultValue string
-	min          int
-	max          int
-}
+	"github.com/soypita/api-generator/apigen"
+)
 
-var structTypesToFunc = make(map[string][]FuncGeneratorDescription)
+var (
+	inPath        = flag.String("in", "", "annotated go file or package directory, $GOFILE by default")
+	outPath       = flag.String("out", "", "write handlers to this file, <file>_apigen.go by default when neither -openapi nor -client is set")
+	buildTags     = flag.String("tags", "", "comma separated list of build tags used to select files of the package")
+	openapiOut    = flag.String("openapi", "", "write an OpenAPI 3.1 document for the annotated handlers to this file")
+	receivers     = flag.String("receivers", "", "comma separated list of receivers to generate, all by default")
+	collectErrors = flag.Bool("collect-errors", false, "report all invalid parameters at once for every endpoint")
+	clientOut     = flag.String("client", "", "write typed http clients of the annotated receivers to this file")
+	clientPackage = flag.String("client-package", "", "package of the client, the package of handlers by default")
+	check         = flag.Bool("check", false, "compare outputs with files on disk instead of writing them, print the diff and exit 1 if they are stale")
+	templatesDir  = flag.String("templates", "", "directory with <name>.tmpl files replacing built-in templates, names are "+strings.Join(apigen.TemplateNames, ", "))
+	withRouter    = flag.Bool("router", false, "add NewRouter serving all generated receivers under their prefixes to handlers")
+	printVersion  = flag.Bool("version", false, "print the version and exit")
+	printHelp     = flag.Bool("help", false, "print this help and exit")
+)
 
-func main() {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, os.Args[1], nil, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
-	}
-	out, _ := os.Create(os.Args[2])
+// version is set by the linker, -ldflags "-X main.version=v1.2.3"
+var version = ""
 
-	fmt.Fprintln(out, `// DO NOT CHANGE`)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: apigen [flags] [in.go|dir [out.go]]")
+	fmt.Fprintln(out, "       apigen config [in.go|dir]")
 	fmt.Fprintln(out)
-	fmt.Fprintln(out, `package `+node.Name.Name)
+	fmt.Fprintln(out, "apigen generates http handlers for methods annotated with apigen:api,")
+	fmt.Fprintln(out, "in go:generate lines the input defaults to $GOFILE:")
 	fmt.Fprintln(out)
-	fmt.Fprintln(out, `import "net/http"`)
-	fmt.Fprintln(out, `import "encoding/json"`)
-	fmt.Fprintln(out, `import "errors"`)
-	fmt.Fprintln(out, `import "fmt"`)
-	fmt.Fprintln(out, `import "strconv"`)
+	fmt.Fprintln(out, "	//go:generate apigen -receivers MyApi")
 	fmt.Fprintln(out)
-
-	fmt.Fprintln(out, `type DefaultResponseWrapper struct {`)
-	fmt.Fprintln(out, "	Error		string "+"`"+`json:"error"`+"`")
-	fmt.Fprintln(out, "	Response	interface{}"+"`"+`json:"response,omitempty"`+"`")
-	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "defaults are read from "+strings.Join(apigen.ConfigNames, ", ")+" found in the package directory")
+	fmt.Fprintln(out, "or its parents up to the module root, apigen config prints them")
 	fmt.Fprintln(out)
+	fmt.Fprintln(out, "flags:")
+	flag.PrintDefaults()
+}
 
-	for _, f := range node.Decls {
-		g, ok := f.(*ast.FuncDecl)
-		if !ok {
-			continue
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("apigen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *printHelp {
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return
+	}
+	if *printVersion {
+		fmt.Println("apigen " + versionString())
+		return
+	}
+
+	// positional arguments are kept for scripts written before the flags
+	args := flag.Args()
+	showConfig := len(args) > 0 && args[0] == "config"
+	if showConfig {
+		args = args[1:]
+	}
+	in, out := *inPath, *outPath
+	if in == "" && len(args) > 0 {
+		in = args[0]
+	}
+	if in == "" {
+		in = os.Getenv("GOFILE")
+	}
+	if out == "" && len(args) > 1 {
+		out = args[1]
+	}
+	if showConfig && in == "" {
+		in = "."
+	}
+	if in == "" || len(args) > 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	if showConfig {
+		configPath, err := apigen.FindConfig(apigen.PackageDir(in))
+		if err != nil {
+			log.Fatal(err)
 		}
-		if g.Recv == nil {
-			continue
+		cfg, err := apigen.LoadConfig(configPath)
+		if err != nil {
+			log.Fatal(err)
 		}
-		if g.Doc == nil {
-			continue
+		if configPath == "" {
+			fmt.Println("# defaults, " + strings.Join(apigen.ConfigNames, " or ") + " is not found")
+		} else {
+			fmt.Println("# " + configPath)
 		}
+		os.Stdout.Write(cfg.YAML())
+		return
+	}
 
-		if !strings.HasPrefix(g.Doc.Text(), "apigen:api") {
-			continue
+	opts := apigen.LoadOptions{}
+	// previous outputs are not parsed, they may be stale
+	for _, name := range []string{out, *clientOut} {
+		if name != "" {
+			opts.Skip = append(opts.Skip, name)
 		}
-
-		generatedStruct := FuncGeneratorDescription{}
-		inParam := strings.TrimPrefix(g.Doc.Text(), "apigen:api ")
-
-		err := json.Unmarshal([]byte(inParam), &generatedStruct)
-		if err != nil {
-			panic(err)
+	}
+	if *receivers != "" {
+		for _, name := range strings.Split(*receivers, ",") {
+			opts.Receivers = append(opts.Receivers, strings.TrimSpace(name))
 		}
-		generatedStruct.funcName = g.Name.Name
-		cur, ok := g.Recv.List[0].Type.(*ast.StarExpr)
+	}
+	if *buildTags != "" {
+		opts.Tags = strings.Split(*buildTags, ",")
+		// the type checker imports packages with the default context
+		build.Default.BuildTags = opts.Tags
+	}
+	m, err := apigen.LoadWithOptions(in, opts)
+	if err != nil {
+		fatal(err)
+	}
+	if out == "" && *openapiOut == "" && *clientOut == "" {
+		out = defaultOutput(in, m.Package)
+	}
 
-		if !ok {
-			generatedStruct.receiverTypeName = g.Recv.List[0].Type.(*ast.Ident).Name
-			generatedStruct.inputBusinessParamName = g.Type.Params.List[1].Type.(*ast.Ident).Name
-			structTypesToFunc[generatedStruct.receiverTypeName] = append(structTypesToFunc[generatedStruct.receiverTypeName], generatedStruct)
-			continue
+	// every output is generated before the first one is written,
+	// so errors do not leave some of them updated
+	outputs := []generatedFile{}
+	if *openapiOut != "" {
+		outputs = append(outputs, generate(m, *openapiOut, apigen.Options{Output: apigen.OpenAPI}))
+	}
+	if *clientOut != "" {
+		// client in the same package uses ValidationError of the handlers
+		if (*clientPackage == "" || *clientPackage == m.Package) && out == "" {
+			log.Fatal("client in package " + m.Package + " needs handlers, set -out or -client-package")
 		}
-		generatedStruct.receiverTypeName = cur.X.(*ast.Ident).Name
-		generatedStruct.inputBusinessParamName = g.Type.Params.List[1].Type.(*ast.Ident).Name
-		structTypesToFunc[generatedStruct.receiverTypeName] = append(structTypesToFunc[generatedStruct.receiverTypeName], generatedStruct)
+		outputs = append(outputs, generate(m, *clientOut, apigen.Options{Output: apigen.Client, ClientPackage: *clientPackage}))
 	}
-	prepeareServeHttpFuncForStructs(out, structTypesToFunc)
-
-	// generate validation function for params with validate fields
-	for _, f := range node.Decls {
-		g, ok := f.(*ast.GenDecl)
-		if !ok {
-			continue
+	if out != "" {
+		outputs = append(outputs, generate(m, out, apigen.Options{
+			Output:        apigen.Handlers,
+			Templates:     *templatesDir,
+			CollectErrors: *collectErrors,
+			Router:        *withRouter,
+		}))
+	}
+	if *check {
+		if checkOutputs(os.Stdout, outputs) {
+			os.Exit(1)
 		}
-		for _, spec := range g.Specs {
-			currType, ok := spec.(*ast.TypeSpec)
-			if !ok {
-				continue
-			}
-
-			_, ok = currType.Type.(*ast.StructType)
-			if !ok {
-				continue
-			}
-			needToValidate := false
-			for _, val := range structTypesToFunc {
-				for _, val := range val {
-					if currType.Name.Name == val.inputBusinessParamName {
-						needToValidate = true
-						break
-					}
-				}
-				if needToValidate {
-					break
-				}
-			}
-			if !needToValidate {
-				continue
-			}
-
-			buildValidationParamCode(out, currType)
+		return
+	}
+	for _, file := range outputs {
+		if err := writeFileAtomic(file.name, file.data); err != nil {
+			log.Fatal(err)
 		}
 	}
 }
 
-func buildValidationParamCode(out *os.File, currType *ast.TypeSpec) {
-	fmt.Fprintln(out, "func (srv *"+currType.Name.Name+") ValidateParams(r *http.Request) error {")
-	currStruct, _ := currType.Type.(*ast.StructType)
-	for _, filed := range currStruct.Fields.List {
-		tagString, _ := reflect.StructTag(filed.Tag.Value[1 : len(filed.Tag.Value)-1]).Lookup("apivalidator")
-		paramsList := strings.Split(tagString, ",")
-		valParams := ValidateAttr{}
-		for _, paramTag := range paramsList {
-			if paramTag == "required" {
-				valParams.isRequired = true
-				continue
-			}
-
-			if strings.Contains(paramTag, "paramname=") {
-				valParams.paramName = strings.TrimPrefix(paramTag, "paramname=")
-			}
-
-			if strings.Contains(paramTag, "default=") {
-				valParams.defaultValue = strings.TrimPrefix(paramTag, "default=")
-			}
+func generate(m *apigen.Model, name string, opts apigen.Options) generatedFile {
+	buf := &bytes.Buffer{}
+	if err := apigen.Generate(m, buf, opts); err != nil {
+		fatal(err)
+	}
+	return generatedFile{name, buf.Bytes()}
+}
 
-			if strings.Contains(paramTag, "enum=") {
-				valParams.enumValues = strings.Split(strings.TrimPrefix(paramTag, "enum="), "|")
-			}
-			if strings.Contains(paramTag, "min=") {
-				minVal, err := strconv.Atoi(strings.TrimPrefix(paramTag, "min="))
-				if err != nil {
-					panic(err)
-				}
-				valParams.min = minVal
-			}
-			if strings.Contains(paramTag, "max=") {
-				maxVal, err := strconv.Atoi(strings.TrimPrefix(paramTag, "max="))
-				if err != nil {
-					panic(err)
-				}
-				valParams.max = maxVal
-			}
+// fatal exits with the error, every problem of ErrorList is printed on its own line
+func fatal(err error) {
+	if list, ok := err.(apigen.ErrorList); ok {
+		for _, e := range list {
+			fmt.Fprintln(os.Stderr, e)
 		}
+		os.Exit(1)
+	}
+	log.Fatal(err)
+}
 
-		// check for param name
-		fieldName := strings.ToLower(filed.Names[0].Name)
-		if valParams.paramName != "" {
-			fieldName = valParams.paramName
+// checkOutputs writes the diff of every stale output and reports whether there were any,
+// missing files are compared as empty ones
+func checkOutputs(out io.Writer, outputs []generatedFile) bool {
+	stale := false
+	for _, file := range outputs {
+		data, err := ioutil.ReadFile(file.name)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
 		}
-
-		variableFieldName := strings.ToLower(filed.Names[0].Name)
-
-		fmt.Fprintln(out, `	`+variableFieldName+` := r.FormValue("`+fieldName+`")`)
-
-		// check if field required or not
-		if valParams.isRequired {
-			fmt.Fprintln(out, `	if `+variableFieldName+` == "" {`)
-			fmt.Fprintln(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must me not empty", "`+fieldName+`")}`)
-			fmt.Fprintln(out, `	}`)
+		if diff := unifiedDiff(file.name, file.name+" (generated)", data, file.data); diff != "" {
+			io.WriteString(out, diff)
+			stale = true
 		}
+	}
+	return stale
+}
 
-		filedType := filed.Type.(*ast.Ident).Name
-
-		switch filedType {
-		case "string":
-			if valParams.defaultValue != "" {
-				fmt.Fprintln(out, "	if "+variableFieldName+` == "" {`)
-				fmt.Fprintln(out, "		"+variableFieldName+" = "+`"`+valParams.defaultValue+`"`)
-				fmt.Fprintln(out, "	}")
-			}
-			if len(valParams.enumValues) > 0 {
-				fmt.Fprintln(out, "	isValueInEnum := false")
-				fmt.Fprint(out, "	validatedEnum := []string{")
-				for _, val := range valParams.enumValues {
-					fmt.Fprint(out, `"`+val+`",`)
-				}
-				fmt.Fprint(out, "}")
-				fmt.Fprintln(out)
-				fmt.Fprintln(out, "	for _, val := range validatedEnum {")
-				fmt.Fprintln(out, "		if "+variableFieldName+" == val {")
-				fmt.Fprintln(out, "			isValueInEnum = true")
-				fmt.Fprintln(out, "		}")
-				fmt.Fprintln(out, "	}")
-				fmt.Fprintln(out, "	if isValueInEnum == false {")
-				fmt.Fprint(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be one of [`+
-					strings.Join(valParams.enumValues, ", ")+
-					`]", "`+fieldName+`")}`)
-				fmt.Fprintln(out, "	}")
-			}
-			if valParams.min != 0 {
-				fmt.Fprintln(out, "	if len("+variableFieldName+`) < `+strconv.Itoa(valParams.min)+` {`)
-				fmt.Fprintln(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s len must be >= %d", "`+fieldName+`",`+strconv.Itoa(valParams.min)+`)}`)
-				fmt.Fprintln(out, `	}`)
-			}
-
-			// assign fieldValue to struct
-			fmt.Fprintln(out, "	srv."+filed.Names[0].Name+" = "+variableFieldName)
-		case "int":
-			if valParams.defaultValue != "" {
-				fmt.Fprintln(out, "	if "+variableFieldName+` == "" {`)
-				fmt.Fprintln(out, "		"+variableFieldName+" = "+`"`+valParams.defaultValue+`"`)
-				fmt.Fprintln(out, "	}")
-			}
-			if len(valParams.enumValues) > 0 {
-				fmt.Fprintln(out, "	isValueInEnum := false")
-				fmt.Fprint(out, "	validatedEnum := []string{")
-				for _, val := range valParams.enumValues {
-					fmt.Fprint(out, `"`+val+`",`)
-				}
-				fmt.Fprint(out, "}")
-				fmt.Fprintln(out)
-				fmt.Fprintln(out, "	for _, val := range validatedEnum {")
-				fmt.Fprintln(out, "		if "+variableFieldName+" == val {")
-				fmt.Fprintln(out, "			isValueInEnum = true")
-				fmt.Fprintln(out, "		}")
-				fmt.Fprintln(out, "	}")
-				fmt.Fprintln(out, "	if isValueInEnum == false {")
-				fmt.Fprint(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be one of [`+
-					strings.Join(valParams.enumValues, ", ")+
-					`]",`+fieldName+`)}`)
-				fmt.Fprintln(out, "	}")
-			}
-			fmt.Fprintln(out, "	int"+filed.Names[0].Name+", err := strconv.Atoi("+variableFieldName+")")
-			fmt.Fprintln(out, "	if err != nil {")
-			fmt.Fprintln(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be int", "`+fieldName+`")}`)
-			fmt.Fprintln(out, "	}")
-
-			fmt.Fprintln(out, "	if int"+filed.Names[0].Name+` < `+strconv.Itoa(valParams.min)+` {`)
-			fmt.Fprintln(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be >= %d", "`+fieldName+`",`+strconv.Itoa(valParams.min)+`)}`)
-			fmt.Fprintln(out, `	}`)
-
-			if valParams.max != 0 {
-				fmt.Fprintln(out, "	if int"+filed.Names[0].Name+`  > `+strconv.Itoa(valParams.max)+` {`)
-				fmt.Fprintln(out, `		return ApiError{http.StatusBadRequest, fmt.Errorf("%s must be <= %d", "`+fieldName+`",`+strconv.Itoa(valParams.max)+`)}`)
-				fmt.Fprintln(out, `	}`)
-			}
-			fmt.Fprintln(out, "	srv."+filed.Names[0].Name+" = int"+filed.Names[0].Name)
+// defaultOutput is <file>_apigen.go next to the input file, or <package>_apigen.go in the input directory
+func defaultOutput(in string, pkgName string) string {
+	if info, err := os.Stat(in); err == nil && info.IsDir() {
+		return filepath.Join(in, pkgName+"_apigen.go")
+	}
+	return strings.TrimSuffix(in, ".go") + "_apigen.go"
+}
 
-		default:
-			panic("only string and int fields available")
-		}
+// versionString is the version set by the linker or the version of the module the binary was built from
+func versionString() string {
+	if version != "" {
+		return version
 	}
-	fmt.Fprintln(out, "	return nil")
-	fmt.Fprintln(out, "}")
-	fmt.Fprintln(out)
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
 }
 
-func prepeareServeHttpFuncForStructs(out *os.File, structTypesToFunc map[string][]FuncGeneratorDescription) {
-	defaultMethod := ""
-	for key, val := range structTypesToFunc {
-		fmt.Fprintln(out, "func (srv *"+key+") ServeHTTP(w http.ResponseWriter, r *http.Request) {")
-		fmt.Fprintln(out, "	switch r.URL.Path {")
-		for _, val := range val {
-			if val.Method != "" {
-				defaultMethod = val.Method
-			}
-			fmt.Fprintln(out, `	case "`+val.Url+`":`)
-			if defaultMethod != "" {
-				fmt.Fprintln(out, `		if r.Method != "`+defaultMethod+`" {`)
-				fmt.Fprintln(out, "			w.WriteHeader(http.StatusNotAcceptable)")
-				fmt.Fprintln(out, "			response := DefaultResponseWrapper{}")
-				fmt.Fprintln(out, `			response.Error = "bad method"`)
-				fmt.Fprintln(out, `			payload, _ := json.Marshal(response)`)
-				fmt.Fprintln(out, "			w.Write(payload)")
-				fmt.Fprintln(out, "			return")
-				fmt.Fprintln(out, "		}")
-			}
-			if val.Auth {
-				fmt.Fprintln(out, `		if r.Header.Get("X-Auth") != "100500" {`)
-				fmt.Fprintln(out, "			w.WriteHeader(http.StatusForbidden)")
-				fmt.Fprintln(out, "			response := DefaultResponseWrapper{}")
-				fmt.Fprintln(out, `			response.Error = "unauthorized"`)
-				fmt.Fprintln(out, `			payload, _ := json.Marshal(response)`)
-				fmt.Fprintln(out, "			w.Write(payload)")
-				fmt.Fprintln(out, "			return")
-				fmt.Fprintln(out, "		}")
-			}
-			fmt.Fprintln(out, "		srv.Wrap"+val.funcName+"(w, r)")
-		}
-		fmt.Fprintln(out, "	default:")
-		fmt.Fprintln(out, "		w.WriteHeader(http.StatusNotFound)")
-		fmt.Fprintln(out, "		response := DefaultResponseWrapper{}")
-		fmt.Fprintln(out, `		response.Error = "unknown method"`)
-		fmt.Fprintln(out, `		payload, _ := json.Marshal(response)`)
-		fmt.Fprintln(out, "		w.Write(payload)")
-		fmt.Fprintln(out, "	}")
-		fmt.Fprintln(out, "}")
+type generatedFile struct {
+	name string
+	data []byte
+}
 
-		for _, val := range val {
-			fmt.Fprintln(out)
-			fmt.Fprintln(out, "func (srv *"+key+") Wrap"+val.funcName+"(w http.ResponseWriter, r *http.Request) {")
-			fmt.Fprintln(out, "	ctx := r.Context()")
-			fmt.Fprintln(out, "	inParam := "+val.inputBusinessParamName+"{}")
-			fmt.Fprintln(out, "	err := inParam.ValidateParams(r)")
-			fmt.Fprintln(out, "	var e ApiError")
-			fmt.Fprintln(out, "	if errors.As(err, &e) {")
-			fmt.Fprintln(out, "		w.WriteHeader(e.HTTPStatus)")
-			fmt.Fprintln(out, "		response := DefaultResponseWrapper{}")
-			fmt.Fprintln(out, "		response.Error = e.Error()")
-			fmt.Fprintln(out, `		payload, _ := json.Marshal(response)`)
-			fmt.Fprintln(out, "		w.Write(payload)")
-			fmt.Fprintln(out, "		return")
-			fmt.Fprintln(out, "	}")
-			fmt.Fprintln(out, "	res, err := srv."+val.funcName+"(ctx, inParam)")
-			fmt.Fprintln(out, "	if errors.As(err, &e) {")
-			fmt.Fprintln(out, "		w.WriteHeader(e.HTTPStatus)")
-			fmt.Fprintln(out, "		response := DefaultResponseWrapper{}")
-			fmt.Fprintln(out, "		response.Error = e.Error()")
-			fmt.Fprintln(out, `		payload, _ := json.Marshal(response)`)
-			fmt.Fprintln(out, "		w.Write(payload)")
-			fmt.Fprintln(out, "		return")
-			fmt.Fprintln(out, "	} else if err != nil {")
-			fmt.Fprintln(out, "		w.WriteHeader(http.StatusInternalServerError)")
-			fmt.Fprintln(out, "		response := DefaultResponseWrapper{}")
-			fmt.Fprintln(out, "		response.Error = err.Error()")
-			fmt.Fprintln(out, `		payload, _ := json.Marshal(response)`)
-			fmt.Fprintln(out, "		w.Write(payload)")
-			fmt.Fprintln(out, "		return")
-			fmt.Fprintln(out, "	}")
-			fmt.Fprintln(out, "	response := DefaultResponseWrapper{}")
-			fmt.Fprintln(out, "	response.Response = res")
-			fmt.Fprintln(out, "	payload, _ := json.Marshal(response)")
-			fmt.Fprintln(out, "	w.WriteHeader(http.StatusOK)")
-			fmt.Fprintln(out, "	w.Write(payload)")
-			fmt.Fprintln(out, "}")
-		}
-		fmt.Fprintln(out)
+// writeFileAtomic replaces the file with complete data, readers never see it half written
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
 	}
+	return err
 }
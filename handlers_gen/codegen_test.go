@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the generator instead of tests in processes started by runApigen
+func TestMain(m *testing.M) {
+	if os.Getenv("APIGEN_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runApigen runs the generator with args in dir and returns its output and exit status
+func runApigen(t *testing.T, dir string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "APIGEN_TEST_MAIN=1", "GOFILE=")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// fixture is a package with one endpoint
+const fixture = `package fixture
+
+import "context"
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string { return ae.Err.Error() }
+
+type S struct{}
+
+type P struct {
+	Name string ` + "`apivalidator:\"required\"`" + `
+}
+
+type R struct{ Name string }
+
+// apigen:api {"url": "/x"}
+func (s *S) X(ctx context.Context, in P) (*R, error) { return &R{in.Name}, nil }
+`
+
+// writeFixture writes the fixture followed by extra declarations to api.go of a new directory
+func writeFixture(t *testing.T, extra string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "api.go"), []byte(fixture+extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExitStatusOfErrors(t *testing.T) {
+	dir := writeFixture(t, `
+type Bad struct {
+	Age int `+"`apivalidator:\"min=abc\"`"+`
+}
+
+// apigen:api {"url": "/broken",
+func (s *S) Broken(ctx context.Context, in P) (*R, error) { return nil, nil }
+
+// apigen:api {"url": "/tag"}
+func (s *S) Tag(ctx context.Context, in Bad) (*R, error) { return nil, nil }
+`)
+
+	_, stderr, code := runApigen(t, dir, "api.go")
+	if code != 1 {
+		t.Errorf("expected exit status 1, got %d", code)
+	}
+	// каждая ошибка на своей строке с позицией
+	expected := "api.go:24:2: field Bad.Age: apivalidator: bad min=abc, number expected\n" +
+		"api.go:27:1: apigen:api: invalid JSON: unexpected end of JSON input\n"
+	if stderr != expected {
+		t.Errorf("unexpected errors\nGot: %q\nExpected: %q", stderr, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api_apigen.go")); !os.IsNotExist(err) {
+		t.Errorf("output is written despite errors: %v", err)
+	}
+}
+
+func TestDefaultOutput(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"api.go", "api_apigen.go"},
+		{filepath.Join("pkg", "api.go"), filepath.Join("pkg", "api_apigen.go")},
+		{dir, filepath.Join(dir, "fixture_apigen.go")},
+	}
+	for _, item := range cases {
+		if got := defaultOutput(item.in, "fixture"); got != item.expected {
+			t.Errorf("[%s] expected %s, got %s", item.in, item.expected, got)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir := writeFixture(t, "")
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// без входного файла печатается справка
+	if _, stderr, code := runApigen(t, dir); code != 2 || !strings.Contains(stderr, "usage: apigen") {
+		t.Errorf("expected usage and exit status 2, got %d %q", code, stderr)
+	}
+	if stdout, _, code := runApigen(t, dir, "-version"); code != 0 || !strings.HasPrefix(stdout, "apigen ") {
+		t.Errorf("unexpected version %d %q", code, stdout)
+	}
+
+	// только OpenAPI, обработчики не пишутся
+	if _, stderr, code := runApigen(t, dir, "-openapi", "openapi.yaml", "api.go"); code != 0 || !exists("openapi.yaml") || exists("api_apigen.go") {
+		t.Errorf("-openapi: exit status %d %q", code, stderr)
+	}
+	// выход по умолчанию рядом с входным файлом
+	if _, stderr, code := runApigen(t, dir, "api.go"); code != 0 || !exists("api_apigen.go") {
+		t.Errorf("default output: exit status %d %q", code, stderr)
+	}
+	// для каталога имя по пакету
+	if _, stderr, code := runApigen(t, dir, "-in", "."); code != 0 || !exists("fixture_apigen.go") {
+		t.Errorf("-in: exit status %d %q", code, stderr)
+	}
+	if _, stderr, code := runApigen(t, dir, "-out", "handlers.go", "-receivers", "S", "api.go"); code != 0 || !exists("handlers.go") {
+		t.Errorf("-out: exit status %d %q", code, stderr)
+	}
+	if _, stderr, code := runApigen(t, dir, "-receivers", "Missing", "api.go"); code != 1 || !strings.Contains(stderr, "receiver Missing has no methods annotated with apigen:api") {
+		t.Errorf("-receivers: exit status %d %q", code, stderr)
+	}
+
+	// -check сравнивает с файлами на диске
+	if stdout, _, code := runApigen(t, dir, "-check", "api.go"); code != 0 || stdout != "" {
+		t.Errorf("-check of fresh output: exit status %d %q", code, stdout)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "api_apigen.go"), []byte("package fixture\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, code := runApigen(t, dir, "-check", "api.go")
+	if code != 1 || !strings.HasPrefix(stdout, "--- api_apigen.go\n+++ api_apigen.go (generated)\n@@ -1 +1,") {
+		t.Errorf("-check of stale output: exit status %d %q", code, stdout)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes in the unified diff
+const diffContext = 3
+
+// diffLine is a line of the edit script, op is ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the difference of files in the unified format, empty when they are equal
+func unifiedDiff(oldName string, newName string, oldData []byte, newData []byte) string {
+	if bytes.Equal(oldData, newData) {
+		return ""
+	}
+	script := diffLines(splitLines(oldData), splitLines(newData))
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "--- "+oldName)
+	fmt.Fprintln(buf, "+++ "+newName)
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(script); {
+		if script[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// a hunk starts with the context before the change and lasts while changes are close to each other
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(script) {
+			if script[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(script) && script[next].op == ' ' && next-end <= 2*diffContext {
+				next++
+			}
+			if next == len(script) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		if end += diffContext; end > len(script) {
+			end = len(script)
+		}
+
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, line := range script[start:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		for _, line := range script[start:end] {
+			buf.WriteByte(line.op)
+			buf.WriteString(line.text)
+			buf.WriteByte('\n')
+		}
+		for _, line := range script[i:end] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the start and the length of the hunk, empty ranges start before the first line
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines builds the shortest edit script with the linear space variant of the Myers algorithm
+func diffLines(a []string, b []string) []diffLine {
+	script := make([]diffLine, 0, len(a)+len(b))
+	return appendDiff(script, a, b)
+}
+
+// appendDiff appends the edit script of a and b, common prefix and suffix are skipped
+// before the middle is split at a point of a shortest path and both halves are diffed
+func appendDiff(script []diffLine, a []string, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		script = append(script, diffLine{' ', a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if x, y, ok := middlePoint(a, b); ok {
+		script = appendDiff(script, a[:x], b[:y])
+		script = appendDiff(script, a[x:], b[y:])
+	} else {
+		for _, line := range a {
+			script = append(script, diffLine{'-', line})
+		}
+		for _, line := range b {
+			script = append(script, diffLine{'+', line})
+		}
+	}
+	for _, line := range common {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+// middlePoint searches shortest paths from both ends of a and b which start and end with different lines,
+// the point where the paths meet splits both into smaller problems, ok is false when a or b is empty
+func middlePoint(a []string, b []string) (x int, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	// forward[offset+k] is the furthest x on diagonal k = x - y from the start,
+	// backward[offset+k] is the same from the end of a and b
+	offset := maxD + 1
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// paths meet in the forward pass when the delta is odd and in the backward pass otherwise
+	odd := delta%2 != 0
+	// diagonals which left the edit graph are skipped
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || k != d && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				if bk := offset + delta - k; bk >= 0 && bk < len(backward) && backward[bk] != -1 && x >= n-backward[bk] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || k != d && backward[offset+k-1] < backward[offset+k+1] {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				if fk := offset + delta - k; fk >= 0 && fk < len(forward) && forward[fk] != -1 && forward[fk] >= n-x {
+					fx := forward[fk]
+					return fx, fx - (delta - k), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines returns n lines "line a", "line b"... where replaced ones are changed or removed when empty
+func lines(n int, replaced map[int]string) string {
+	res := []string{}
+	for i := 1; i <= n; i++ {
+		if text, ok := replaced[i]; ok {
+			if text != "" {
+				res = append(res, text)
+			}
+			continue
+		}
+		res = append(res, "line "+string(rune('a'+i-1)))
+	}
+	return strings.Join(res, "\n") + "\n"
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"new file", "", "a\nb\n", "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed file", "a\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n"},
+		{
+			"change in the middle",
+			lines(9, nil), lines(9, map[int]string{5: "changed"}),
+			"--- old\n+++ new\n@@ -2,7 +2,7 @@\n line b\n line c\n line d\n-line e\n+changed\n line f\n line g\n line h\n",
+		},
+		{
+			"insertion at the start",
+			lines(5, nil), "new\n" + lines(5, nil),
+			"--- old\n+++ new\n@@ -1,3 +1,4 @@\n+new\n line a\n line b\n line c\n",
+		},
+		{
+			"deletion at the end",
+			lines(5, nil), lines(5, map[int]string{5: ""}),
+			"--- old\n+++ new\n@@ -2,4 +2,3 @@\n line b\n line c\n line d\n-line e\n",
+		},
+		{
+			"close changes share the hunk",
+			lines(12, nil), lines(12, map[int]string{3: "x", 9: "y"}),
+			"--- old\n+++ new\n@@ -1,12 +1,12 @@\n line a\n line b\n-line c\n+x\n line d\n line e\n line f\n line g\n line h\n-line i\n+y\n line j\n line k\n line l\n",
+		},
+		{
+			"distant changes get own hunks",
+			lines(20, nil), lines(20, map[int]string{2: "x", 18: "y"}),
+			"--- old\n+++ new\n@@ -1,5 +1,5 @@\n line a\n-line b\n+x\n line c\n line d\n line e\n@@ -15,6 +15,6 @@\n line o\n line p\n line q\n-line r\n+y\n line s\n line t\n",
+		},
+	}
+	for _, item := range cases {
+		if got := unifiedDiff("old", "new", []byte(item.old), []byte(item.new)); got != item.expected {
+			t.Errorf("[%s] unexpected diff\nGot:\n%s\nExpected:\n%s", item.name, got, item.expected)
+		}
+	}
+}
+
+func TestDiffLinesIsShortest(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	changed := 0
+	for _, line := range diffLines(a, b) {
+		if line.op != ' ' {
+			changed++
+		}
+	}
+	// пример из статьи Майерса, кратчайший скрипт из 5 правок
+	if changed != 5 {
+		t.Errorf("expected 5 edits, got %d", changed)
+	}
+}
@@ -11,9 +11,9 @@ import (
 )
 
 func main() {
-	// будет вызван метод ServeHTTP у структуры MyApi
-	http.Handle("/user/", NewMyApi())
+	// OtherApi доступен под префиксом /other, остальные пути обслуживает MyApi
+	router := NewRouter(NewMyApi(), NewOtherApi())
 
 	fmt.Println("starting server at :8080")
-	http.ListenAndServe(":8080", nil)
+	http.ListenAndServe(":8080", router)
 }
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/soypita/api-generator/apitypes"
 )
 
 func CheckoutDummy(w http.ResponseWriter, r *http.Request) {
@@ -24,7 +28,9 @@ type Case struct {
 	Method string // GET по-умолчанию в http.NewRequest если передали пустую строку
 	Path   string
 	Query  string
+	Body   string // JSON тело запроса, вместо Query
 	Auth   bool
+	Token  string // X-Auth вместо токена по-умолчанию
 	Status int
 	Result interface{}
 }
@@ -104,6 +110,304 @@ func TestMyApi(t *testing.T) {
 			},
 		},
 		// ------
+		Case{ // числовые и булевы параметры, limit по-умолчанию
+			Path:   "/user/list",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 2,
+					"users": []CR{CR{
+						"id":        41,
+						"login":     "vpupkin",
+						"full_name": "Vasily Pupkin",
+						"status":    0,
+					}, CR{
+						"id":        42,
+						"login":     "rvasily",
+						"full_name": "Vasily Romanov",
+						"status":    20,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "limit=1&offset=1",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 2,
+					"users": []CR{CR{
+						"id":        42,
+						"login":     "rvasily",
+						"full_name": "Vasily Romanov",
+						"status":    20,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "admins=1",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 1,
+					"users": []CR{CR{
+						"id":        42,
+						"login":     "rvasily",
+						"full_name": "Vasily Romanov",
+						"status":    20,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "min_status=10.5",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 1,
+					"users": []CR{CR{
+						"id":        42,
+						"login":     "rvasily",
+						"full_name": "Vasily Romanov",
+						"status":    20,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "limit=0",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "limit must be >= 1",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "limit=-1",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "limit must be uint32",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "limit=4294967296",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "limit is out of uint32 range",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "offset=-5",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "offset must be >= 0",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "admins=yes",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "admins must be bool",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "min_status=abc",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "min_status must be float64",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "min_status=20.5",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "min_status must be <= 20",
+			},
+		},
+		Case{ // повторяющиеся параметры
+			Path:   "/user/list",
+			Query:  "login=rvasily&login=vpupkin",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 2,
+					"users": []CR{CR{
+						"id":        41,
+						"login":     "vpupkin",
+						"full_name": "Vasily Pupkin",
+						"status":    0,
+					}, CR{
+						"id":        42,
+						"login":     "rvasily",
+						"full_name": "Vasily Romanov",
+						"status":    20,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "status=0,10",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 1,
+					"users": []CR{CR{
+						"id":        41,
+						"login":     "vpupkin",
+						"full_name": "Vasily Pupkin",
+						"status":    0,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "login=a&login=b&login=c&login=d",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "login must have at most 3 items",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "login=rvasily&login=rvasily",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "login items must be unique, rvasily is repeated",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "status=0&status=30",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "status must be <= 20",
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Query:  "status=x",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "status must be int",
+			},
+		},
+		Case{ // массив в JSON теле
+			Path:   "/user/list",
+			Method: http.MethodPost,
+			Body:   `{"login": ["vpupkin"], "status": [0, 20]}`,
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 1,
+					"users": []CR{CR{
+						"id":        41,
+						"login":     "vpupkin",
+						"full_name": "Vasily Pupkin",
+						"status":    0,
+					}},
+				},
+			},
+		},
+		Case{
+			Path:   "/user/list",
+			Method: http.MethodPost,
+			Body:   `{"login": "vpupkin"}`,
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "login must be array",
+			},
+		},
+		Case{ // параметр из пути
+			Path:   "/user/rvasily/profile",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+		Case{
+			Path:   "/user/not_exist_user/profile",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "user not exist",
+			},
+		},
+		Case{ // типизированный параметр из пути
+			Path:   "/user/by-id/42",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+		Case{
+			Path:   "/user/by-id/0",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "id must be >= 1",
+			},
+		},
+		Case{ // сегмент не подходит под тип - роут не найден
+			Path:   "/user/by-id/abc",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+		Case{ // все ошибки валидации сразу
+			Path:   "/user/create/check",
+			Query:  "login=short&age=256&status=adm",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "validation failed",
+				"fields": CR{
+					"login":  "len must be >= 10",
+					"status": "must be one of [user, moderator, admin]",
+					"age":    "must be <= 128",
+				},
+			},
+		},
+		Case{
+			Path:   "/user/create/check",
+			Query:  "login=long_enough&age=20",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"valid": true,
+				},
+			},
+		},
+		// ------
 		Case{ // создаём юзера
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
@@ -136,7 +440,7 @@ func TestMyApi(t *testing.T) {
 			Path:   ApiUserCreate,
 			Method: http.MethodGet,
 			Query:  "login=mr.moderator&age=32&status=moderator&full_name=GetMethod",
-			Status: http.StatusNotAcceptable,
+			Status: http.StatusMethodNotAllowed,
 			Auth:   true,
 			Result: CR{
 				"error": "bad method",
@@ -152,6 +456,16 @@ func TestMyApi(t *testing.T) {
 				"error": "unauthorized",
 			},
 		},
+		Case{ // создавать пользователей могут только admin и moderator
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=mr.moderator2&age=32&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusForbidden,
+			Token:  "100501",
+			Result: CR{
+				"error": "forbidden",
+			},
+		},
 		Case{
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
@@ -245,6 +559,92 @@ func TestMyApi(t *testing.T) {
 				"error": "bad user",
 			},
 		},
+		Case{ // параметры в JSON теле
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Body:   `{"login": "json_moderator", "age": 32, "status": "moderator", "full_name": "Json Ivanov"}`,
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 45,
+				},
+			},
+		},
+		Case{
+			Path:   ApiUserProfile,
+			Query:  "login=json_moderator",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        45,
+					"login":     "json_moderator",
+					"full_name": "Json Ivanov",
+					"status":    10,
+				},
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Body:   `{"login": "json_moderator2",`,
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "malformed JSON body: unexpected EOF",
+			},
+		},
+		Case{ // тело больше 10 МБ
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Body:   `{"login": "` + strings.Repeat("a", 10<<20) + `"}`,
+			Status: http.StatusRequestEntityTooLarge,
+			Auth:   true,
+			Result: CR{
+				"error": "JSON body exceeds 10485760 bytes",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Body:   `{"login": "json_moderator2", "age": "32"}`,
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "age must be int",
+			},
+		},
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Body:   `{"age": 32}`,
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "login must me not empty",
+			},
+		},
+		Case{ // параметры из другого пакета
+			Path:   "/user/count",
+			Query:  "status=admin",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"total": 1,
+				},
+			},
+		},
+		Case{
+			Path:   "/user/count",
+			Query:  "status=root",
+			Status: http.StatusBadRequest,
+			Result: CR{
+				"error": "status must be one of [user, moderator, admin]",
+			},
+		},
 	}
 
 	runTests(t, ts, cases)
@@ -285,6 +685,482 @@ func TestOtherApi(t *testing.T) {
 	runTests(t, ts, cases)
 }
 
+func TestMyApiMethods(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	cases := []struct {
+		Method string
+		Path   string
+		Status int
+		Allow  string
+		Body   string
+	}{
+		{http.MethodGet, ApiUserCreate, http.StatusMethodNotAllowed, "OPTIONS, POST", `{"error":"bad method"}`},
+		{http.MethodDelete, "/user/count", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST", `{"error":"bad method"}`},
+		{http.MethodOptions, "/user/count", http.StatusNoContent, "GET, HEAD, OPTIONS, POST", ""},
+		{http.MethodHead, "/user/count?status=admin", http.StatusOK, "", ""},
+		{http.MethodPost, "/user/count?status=admin", http.StatusOK, "", `{"error":"","response":{"total":1}}`},
+		// без списка методов принимается любой
+		{http.MethodPut, ApiUserProfile + "?login=rvasily", http.StatusOK, "", ""},
+	}
+	for idx, item := range cases {
+		req, _ := http.NewRequest(item.Method, ts.URL+item.Path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("[%d] request error: %v", idx, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%d] %s %s: expected http status %v, got %v", idx, item.Method, item.Path, item.Status, resp.StatusCode)
+		}
+		if allow := resp.Header.Get("Allow"); allow != item.Allow {
+			t.Errorf("[%d] %s %s: expected Allow %q, got %q", idx, item.Method, item.Path, item.Allow, allow)
+		}
+		if item.Body != "" && string(body) != item.Body || item.Method == http.MethodHead && len(body) != 0 {
+			t.Errorf("[%d] %s %s: unexpected body %s", idx, item.Method, item.Path, body)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	ts := httptest.NewServer(NewRouter(NewMyApi(), NewOtherApi()))
+	defer ts.Close()
+
+	cases := []Case{
+		Case{ // MyApi без префикса
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=router_user&age=32&status=user&full_name=Router",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 43,
+				},
+			},
+		},
+		Case{ // OtherApi под префиксом /other
+			Path:   "/other" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "I3apBap",
+					"full_name": "Vasily",
+					"level":     1,
+				},
+			},
+		},
+		Case{
+			Path:   "/user/by-id/42",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+		Case{
+			Path:   "/other/user/profile",
+			Query:  "login=rvasily",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+// traceMiddleware запоминает эндпоинты, через которые прошли запросы
+func traceMiddleware(calls *[]string, name string) Middleware {
+	return func(ep Endpoint) Endpoint {
+		next := ep.Handler
+		info := fmt.Sprintf("%s %s.%s %s %v %v", name, ep.Receiver, ep.FuncName, ep.URL, ep.Methods, ep.Auth)
+		ep.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*calls = append(*calls, info)
+			next.ServeHTTP(w, r)
+		})
+		return ep
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(NewRouter(NewMyApi(), NewOtherApi(), Use(traceMiddleware(&calls, "first"), traceMiddleware(&calls, "second")), Use(traceMiddleware(&calls, "third"))))
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/other" + ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "username=I3apBap&level=1&class=warrior&account_name=Vasily",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        12,
+					"login":     "I3apBap",
+					"full_name": "Vasily",
+					"level":     1,
+				},
+			},
+		},
+		Case{ // метод без эндпоинта тоже проходит через middleware
+			Path:   "/user/count",
+			Method: http.MethodDelete,
+			Status: http.StatusMethodNotAllowed,
+			Result: CR{
+				"error": "bad method",
+			},
+		},
+		Case{
+			Path:   "/unknown",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	})
+
+	expected := []string{
+		"first OtherApi.Create /user/create [POST] true",
+		"second OtherApi.Create /user/create [POST] true",
+		"third OtherApi.Create /user/create [POST] true",
+		"first MyApi. /user/count [GET HEAD OPTIONS POST] false",
+		"second MyApi. /user/count [GET HEAD OPTIONS POST] false",
+		"third MyApi. /user/count [GET HEAD OPTIONS POST] false",
+		"first .  [] false",
+		"second .  [] false",
+		"third .  [] false",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected middleware calls\nGot: %#v\nExpected: %#v", calls, expected)
+	}
+}
+
+func TestHandlerMiddleware(t *testing.T) {
+	calls := []string{}
+	ts := httptest.NewServer(NewMyApiHandler(NewMyApi(), Use(traceMiddleware(&calls, "trace"))))
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{ // middleware видит ответ до вызова метода
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=mr.moderator&age=32&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusForbidden,
+			Result: CR{
+				"error": "unauthorized",
+			},
+		},
+		Case{
+			Path:   "/unknown",
+			Status: http.StatusNotFound,
+			Result: CR{
+				"error": "unknown method",
+			},
+		},
+	})
+
+	expected := []string{
+		"trace MyApi.Create /user/create [POST] true",
+		"trace MyApi.  [] false",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("unexpected middleware calls\nGot: %#v\nExpected: %#v", calls, expected)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	api := NewMyApi()
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/user/panic_user/profile",
+			Status: http.StatusInternalServerError,
+			Result: CR{
+				"error": "internal error",
+			},
+		},
+		Case{ // таймаут из аннотации
+			Path:   "/user/slow_user/profile",
+			Status: http.StatusGatewayTimeout,
+			Result: CR{
+				"error": "timeout",
+			},
+		},
+		Case{ // сервер продолжает работать
+			Path:   ApiUserProfile,
+			Query:  "login=rvasily",
+			Status: http.StatusOK,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id":        42,
+					"login":     "rvasily",
+					"full_name": "Vasily Romanov",
+					"status":    20,
+				},
+			},
+		},
+	})
+
+	// метод, не проверяющий контекст, не задерживает ответ
+	start := time.Now()
+	runTests(t, ts, []Case{
+		Case{
+			Path:   "/user/lazy_user/profile",
+			Status: http.StatusGatewayTimeout,
+			Result: CR{
+				"error": "timeout",
+			},
+		},
+	})
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("timeout is answered after %v", elapsed)
+	}
+
+	expected := []string{"UserProfile: panic user"}
+	if !reflect.DeepEqual(api.panics, expected) {
+		t.Errorf("unexpected panics\nGot: %#v\nExpected: %#v", api.panics, expected)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	// у нового обработчика свой лимитер
+	ts := httptest.NewServer(NewOtherApiHandler(NewOtherApi()))
+	defer ts.Close()
+
+	for i := 0; i <= 10; i++ {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+ApiUserCreate, strings.NewReader("username=I3apBap&level=1&class=warrior&account_name=Vasily"))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("X-Auth", "100500")
+		req.Header.Add("X-Client", "TestRateLimit")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("[%d] request error: %v", i, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if i < 10 {
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("[%d] expected http status %v, got %v", i, http.StatusOK, resp.StatusCode)
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || string(body) != `{"error":"too many requests"}` {
+			t.Errorf("[%d] expected too many requests, got %v %s", i, resp.StatusCode, body)
+		}
+		// токен добавляется раз в 6 секунд
+		if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 6 {
+			t.Errorf("[%d] unexpected Retry-After %q", i, resp.Header.Get("Retry-After"))
+		}
+	}
+
+	// ServeHTTP самого OtherApi не хранит корзин и не делит их с другими обработчиками
+	other := httptest.NewServer(NewOtherApi())
+	defer other.Close()
+	req, _ := http.NewRequest(http.MethodPost, other.URL+ApiUserCreate, strings.NewReader("username=I3apBap&level=1&class=warrior&account_name=Vasily"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("X-Auth", "100500")
+	req.Header.Add("X-Client", "TestRateLimit")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected http status %v from OtherApi, got %v", http.StatusOK, resp.StatusCode)
+	}
+}
+
+// keysLimiter запоминает ключи и пропускает все запросы
+type keysLimiter struct {
+	keys []string
+}
+
+func (l *keysLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	l.keys = append(l.keys, key)
+	return true, 0, nil
+}
+
+func TestRateLimitKey(t *testing.T) {
+	limiter := &keysLimiter{}
+	ts := httptest.NewServer(NewMyApiHandler(NewMyApi(), WithLimiter(limiter)))
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		Case{
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=mr.moderator&age=32&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusOK,
+			Auth:   true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 43,
+				},
+			},
+		},
+	})
+
+	// ключом служит логин из RateLimitKey
+	expected := []string{"MyApi.Create rvasily"}
+	if !reflect.DeepEqual(limiter.keys, expected) {
+		t.Errorf("unexpected limiter keys\nGot: %#v\nExpected: %#v", limiter.keys, expected)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+
+	cases := []struct {
+		Method    string
+		Path      string
+		Origin    string
+		Requested string // Access-Control-Request-Method
+		Status    int
+		Headers   map[string]string
+	}{
+		{http.MethodOptions, ApiUserCreate, "https://example.com", http.MethodPost, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin":      "https://example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "POST",
+			"Access-Control-Allow-Headers":     "Content-Type, X-Auth",
+			"Access-Control-Max-Age":           "600",
+			"Vary":                             "Origin",
+		}},
+		{http.MethodOptions, ApiUserCreate, "https://evil.com", http.MethodPost, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin":  "",
+			"Access-Control-Allow-Methods": "",
+		}},
+		// без списка методов разрешается запрошенный
+		{http.MethodOptions, ApiUserProfile, "https://example.com", http.MethodPut, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin":  "https://example.com",
+			"Access-Control-Allow-Methods": "PUT",
+		}},
+		{http.MethodGet, ApiUserProfile + "?login=rvasily", "https://example.com", "", http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin":      "https://example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Vary":                             "Origin",
+		}},
+		// настройки эндпоинта заменяют настройки MyApi
+		{http.MethodOptions, "/user/count", "https://other.com", http.MethodGet, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin":      "*",
+			"Access-Control-Allow-Credentials": "",
+			"Access-Control-Allow-Methods":     "GET, POST, HEAD",
+			"Access-Control-Allow-Headers":     "X-Client",
+			"Access-Control-Max-Age":           "",
+		}},
+		{http.MethodGet, "/user/count?status=user", "https://other.com", "", http.StatusOK, map[string]string{
+			"Access-Control-Allow-Origin": "*",
+		}},
+		// без Origin это обычный OPTIONS
+		{http.MethodOptions, "/user/count", "", http.MethodGet, http.StatusNoContent, map[string]string{
+			"Access-Control-Allow-Origin": "",
+			"Allow":                       "GET, HEAD, OPTIONS, POST",
+		}},
+	}
+	for idx, item := range cases {
+		req, _ := http.NewRequest(item.Method, ts.URL+item.Path, nil)
+		if item.Origin != "" {
+			req.Header.Set("Origin", item.Origin)
+		}
+		if item.Requested != "" {
+			req.Header.Set("Access-Control-Request-Method", item.Requested)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("[%d] request error: %v", idx, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%d] %s %s: expected http status %v, got %v", idx, item.Method, item.Path, item.Status, resp.StatusCode)
+		}
+		for name, value := range item.Headers {
+			if got := resp.Header.Get(name); got != value {
+				t.Errorf("[%d] %s %s: expected %s %q, got %q", idx, item.Method, item.Path, name, value, got)
+			}
+		}
+	}
+}
+
+func TestMyApiClient(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+	defer ts.Close()
+	ctx := context.Background()
+	api := NewMyApiClient(ts.URL, "100500")
+
+	user, err := api.Profile(ctx, ProfileParams{Login: "rvasily"})
+	if err != nil || user.ID != 42 || user.FullName != "Vasily Romanov" {
+		t.Errorf("unexpected profile: %#v, %v", user, err)
+	}
+
+	_, err = api.Profile(ctx, ProfileParams{})
+	if e, ok := err.(ApiError); !ok || e.HTTPStatus != http.StatusBadRequest || e.Error() != "login must me not empty" {
+		t.Errorf("expected bad request, got %#v", err)
+	}
+
+	user, err = api.UserByID(ctx, UserIDParams{ID: 42})
+	if err != nil || user.Login != "rvasily" {
+		t.Errorf("unexpected user by id: %#v, %v", user, err)
+	}
+
+	list, err := api.List(ctx, ListParams{Logins: []string{"rvasily", "vpupkin"}, Statuses: []int{20}})
+	if err != nil || list.Total != 1 || list.Users[0].Login != "rvasily" {
+		t.Errorf("unexpected list: %#v, %v", list, err)
+	}
+
+	count, err := api.Count(ctx, apitypes.CountParams{Status: "user"})
+	if err != nil || count.Total != 1 {
+		t.Errorf("unexpected count: %#v, %v", count, err)
+	}
+
+	_, err = api.CheckCreate(ctx, CreateParams{Login: "short", Age: 200})
+	expectedFields := map[string]string{
+		"login": "len must be >= 10",
+		"age":   "must be <= 128",
+	}
+	if e, ok := err.(ApiError); !ok || e.HTTPStatus != http.StatusBadRequest || !reflect.DeepEqual(e.Err, ValidationError{expectedFields}) {
+		t.Errorf("expected validation error, got %#v", err)
+	}
+
+	params := CreateParams{Login: "new user with/slash", Name: "New User", Status: "moderator"}
+	_, err = NewMyApiClient(ts.URL, "100501").Create(ctx, params)
+	if e, ok := err.(ApiError); !ok || e.HTTPStatus != http.StatusForbidden {
+		t.Errorf("expected forbidden, got %#v", err)
+	}
+	created, err := api.Create(ctx, params)
+	if err != nil || created.ID == 0 {
+		t.Fatalf("unexpected create result: %#v, %v", created, err)
+	}
+	user, err = api.UserProfile(ctx, UserPathParams{Login: UserLogin(params.Login)})
+	if err != nil || user.ID != created.ID || user.FullName != "New User" {
+		t.Errorf("unexpected created user: %#v, %v", user, err)
+	}
+}
+
 func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 	for idx, item := range cases {
 		var (
@@ -296,7 +1172,11 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 
 		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
 
-		if item.Method == http.MethodPost {
+		if item.Body != "" {
+			reqBody := strings.NewReader(item.Body)
+			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
+			req.Header.Add("Content-Type", "application/json")
+		} else if item.Method == http.MethodPost {
 			reqBody := strings.NewReader(item.Query)
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
 			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -304,7 +1184,9 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path+"?"+item.Query, nil)
 		}
 
-		if item.Auth {
+		if item.Token != "" {
+			req.Header.Add("X-Auth", item.Token)
+		} else if item.Auth {
 			req.Header.Add("X-Auth", "100500")
 		}
 